@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/funny-falcon/go-funlz"
+)
+
+/* dumper prints tokens and summary of every segment ended with flush mark */
+type dumper struct {
+	w     io.Writer
+	n     int /* bytes of token data printed */
+	seg   int
+	start int64 /* compressed offset of segment */
+	cnt   counts
+}
+
+type counts struct {
+	tokens, lits, litBytes, copies, copyBytes int64
+}
+
+/*
+dumpMain implements
+
+	funlz dump [-raw] [-dict file] [-n bytes] [file ...]
+*/
+func dumpMain(args []string) int {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	rawDump := fs.Bool("raw", false, "input is raw stream without framing")
+	dictName := fs.String("dict", "", "file with preset dictionary")
+	n := fs.Int("n", 32, "max bytes of token data to print")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: funlz dump [flags] [file ...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	var dict *funlz.Dictionary
+	if *dictName != "" {
+		data, err := ioutil.ReadFile(*dictName)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		dict = funlz.NewDictionary(data)
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	out := bufio.NewWriter(os.Stdout)
+	failed := false
+	for _, name := range files {
+		in, _, err := openInput(name)
+		if err == nil {
+			d := &dumper{w: out, n: *n}
+			if *rawDump {
+				err = d.tokens(funlz.NewTokenReaderDict(bufio.NewReader(in), dict), 0, 0)
+			} else {
+				err = d.frame(bufio.NewReader(in), dict)
+			}
+			in.Close()
+		}
+		out.Flush()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "funlz: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (d *dumper) frame(r io.Reader, dict *funlz.Dictionary) error {
+	f, err := funlz.NewFrameReaderDict(r, dict)
+	switch err {
+	case nil:
+	case funlz.ErrHeader:
+		return errors.New("not a frame, use -raw for raw stream")
+	case funlz.ErrDictionary:
+		return errors.New("frame needs other dictionary, use -dict")
+	default:
+		return err
+	}
+	if size := f.ContentSize(); size >= 0 {
+		fmt.Fprintf(d.w, "frame, content size %d\n", size)
+	} else {
+		fmt.Fprintf(d.w, "frame, content size unknown\n")
+	}
+	var upos int64
+	for {
+		s, err := f.NextSegment()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if s.Type == funlz.SegmentTrailer {
+			fmt.Fprintf(d.w, "trailer at %d: uncompressed %d\n", s.Offset, s.Uncompressed)
+			continue
+		}
+		fmt.Fprintf(d.w, "segment header at %d: compressed %d, uncompressed %d, type %d",
+			s.Offset, len(s.Payload), s.Uncompressed, s.Type)
+		if s.HasChecksum {
+			fmt.Fprintf(d.w, ", crc32c %08x", s.Checksum)
+		}
+		fmt.Fprintln(d.w)
+		switch s.Type {
+		case funlz.SegmentHuffman:
+			fmt.Fprintf(d.w, "-- huffman coded segment at %d, tokens are not shown\n", s.PayloadOffset)
+		case funlz.SegmentStored:
+			fmt.Fprintf(d.w, "-- stored segment at %d, %s\n", s.PayloadOffset, d.quote(s.Payload))
+		default:
+			if err = d.tokens(s.Tokens(), s.PayloadOffset, upos); err != nil {
+				return err
+			}
+		}
+		upos += s.Uncompressed
+	}
+}
+
+/* tokens prints tokens, base and ubase are offsets of stream in file and in uncompressed data */
+func (d *dumper) tokens(tr *funlz.TokenReader, base, ubase int64) error {
+	if d.seg == 0 {
+		fmt.Fprintf(d.w, "%10s %10s  %-11s %4s %4s  %s\n", "pos", "out", "kind", "len", "off", "data")
+	}
+	d.start = base
+	for {
+		tok, err := tr.Next()
+		if err == io.EOF {
+			if d.cnt.tokens != 0 {
+				d.summary(base + tok.Pos)
+			}
+			return nil
+		} else if err != nil {
+			/* report offsets in whole input */
+			switch e := err.(type) {
+			case *funlz.CorruptError:
+				e.Offset += base
+			case *funlz.TruncatedError:
+				e.Offset += base
+			}
+			return err
+		}
+		d.cnt.tokens++
+		pos, out := base+tok.Pos, ubase+tok.Out
+		switch tok.Kind {
+		case funlz.FlushMark:
+			fmt.Fprintf(d.w, "%10d %10d  %s\n", pos, out, tok.Kind)
+			d.summary(pos + 1)
+			continue
+		case funlz.SmallLiteral, funlz.BigLiteral:
+			d.cnt.lits++
+			d.cnt.litBytes += int64(tok.Length)
+			fmt.Fprintf(d.w, "%10d %10d  %-11s %4d %4s  %s\n", pos, out, tok.Kind, tok.Length, "", d.quote(tok.Data))
+		default:
+			d.cnt.copies++
+			d.cnt.copyBytes += int64(tok.Length)
+			fmt.Fprintf(d.w, "%10d %10d  %-11s %4d %4d  %s\n", pos, out, tok.Kind, tok.Length, tok.Offset, d.quote(tok.Data))
+		}
+	}
+}
+
+func (d *dumper) quote(b []byte) string {
+	if len(b) > d.n {
+		return strconv.Quote(string(b[:d.n])) + "..."
+	}
+	return strconv.Quote(string(b))
+}
+
+/* summary prints counters of segment ended before end and resets them */
+func (d *dumper) summary(end int64) {
+	d.seg++
+	c := &d.cnt
+	fmt.Fprintf(d.w, "-- segment %d: %d tokens, %d literals (%d bytes), %d copies (%d bytes), %d => %d bytes\n",
+		d.seg, c.tokens, c.lits, c.litBytes, c.copies, c.copyBytes, end-d.start, c.litBytes+c.copyBytes)
+	d.start = end
+	*c = counts{}
+}
@@ -0,0 +1,313 @@
+/*
+funlz compresses and decompresses files in funlz frame format.
+
+	funlz [flags] [file ...]
+
+Without files, or with "-", it works from standard input to standard output.
+Compressed file gets suffix .flz, and original file is removed unless -k is given.
+Flags mimic gzip:
+
+	-d	decompress
+	-c	write to standard output, keep input files
+	-k	keep input files
+	-f	overwrite existing output files, write compressed data to terminal
+	-t	test integrity of compressed files
+	-v	print compression ratio
+	-S suf	use suffix suf instead of .flz
+	-level n	compression level 1..10
+	-raw	use raw stream without framing and checksums
+	-huffman	Huffman code segments: slower, but smaller
+
+Dump prints every token of compressed files with its offset, kind, length,
+copy offset and decoded bytes, and summary of every segment:
+
+	funlz dump [-raw] [-dict file] [-n bytes] [file ...]
+*/
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/funny-falcon/go-funlz"
+)
+
+var (
+	decomp  = flag.Bool("d", false, "decompress")
+	stdout  = flag.Bool("c", false, "write to standard output, keep input files")
+	keep    = flag.Bool("k", false, "keep input files")
+	force   = flag.Bool("f", false, "overwrite existing output files")
+	test    = flag.Bool("t", false, "test integrity of compressed files")
+	verbose = flag.Bool("v", false, "print compression ratio")
+	suffix  = flag.String("S", ".flz", "suffix of compressed files")
+	level   = flag.Int("level", funlz.DefaultCompression, "compression level 1..10")
+	raw     = flag.Bool("raw", false, "use raw stream without framing")
+	huffman = flag.Bool("huffman", false, "Huffman code segments")
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "dump" {
+		os.Exit(dumpMain(os.Args[2:]))
+	}
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: funlz [flags] [file ...]\n       funlz dump [flags] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *suffix == "" {
+		fatalf("suffix should not be empty")
+	}
+	if _, err := funlz.LevelOptions(*level); err != nil {
+		fatalf("%v", err)
+	}
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	failed := false
+	for _, name := range files {
+		var err error
+		switch {
+		case *test:
+			err = testFile(name)
+		case *decomp:
+			err = decompressFile(name)
+		default:
+			err = compressFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "funlz: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "funlz: "+format+"\n", args...)
+	os.Exit(2)
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+/* openInput returns input file and its size, or -1 if size is unknown */
+func openInput(name string) (*os.File, int64, error) {
+	if name == "-" {
+		return os.Stdin, -1, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if !st.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, errors.New("not a regular file")
+	}
+	return f, st.Size(), nil
+}
+
+/* output writes to file created near input, or to standard output */
+type output struct {
+	f    *os.File
+	w    *bufio.Writer
+	name string
+}
+
+func createOutput(in, name string) (*output, error) {
+	if in == "-" || *stdout {
+		return &output{f: os.Stdout, w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	st, err := os.Stat(in)
+	if err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(name, flags, st.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	return &output{f: f, w: bufio.NewWriter(f), name: name}, nil
+}
+
+/* close finishes output, partial file is removed on error */
+func (o *output) close(err error) error {
+	if ferr := o.w.Flush(); err == nil {
+		err = ferr
+	}
+	if o.name == "" {
+		return err
+	}
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(o.name)
+	}
+	return err
+}
+
+/* finish removes input file if it is not kept */
+func finish(in string) error {
+	if in == "-" || *stdout || *keep {
+		return nil
+	}
+	return os.Remove(in)
+}
+
+type counter struct {
+	n int64
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+func report(name string, orig, comp int64) {
+	if !*verbose || comp < 0 {
+		return
+	}
+	ratio := 0.0
+	if orig > 0 {
+		ratio = 100 * (1 - float64(comp)/float64(orig))
+	}
+	fmt.Fprintf(os.Stderr, "%s:\t%5.1f%% (%d => %d)\n", name, ratio, orig, comp)
+}
+
+func compressFile(name string) (err error) {
+	if name != "-" && strings.HasSuffix(name, *suffix) && !*force {
+		return fmt.Errorf("already has %s suffix", *suffix)
+	}
+	if (name == "-" || *stdout) && isTerminal(os.Stdout) && !*force {
+		return errors.New("compressed data not written to a terminal, use -f to force")
+	}
+	in, size, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(name, name+*suffix)
+	if err != nil {
+		return err
+	}
+	var cnt counter
+	n, err := compress(io.MultiWriter(out.w, &cnt), in, size)
+	if err = out.close(err); err != nil {
+		return err
+	}
+	report(name, n, cnt.n)
+	return finish(name)
+}
+
+func compress(w io.Writer, r io.Reader, size int64) (n int64, err error) {
+	o, _ := funlz.LevelOptions(*level)
+	if *raw {
+		var z *funlz.Writer
+		z, _ = funlz.NewWriterOptions(w, o)
+		if n, err = io.Copy(z, r); err == nil {
+			err = z.Close()
+		}
+		return
+	}
+	fo := funlz.FrameOptions{Options: o, Checksum: true, HasContentSize: size >= 0, ContentSize: size, Huffman: *huffman, Store: true}
+	z, err := funlz.NewFrameWriterOptions(w, fo)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = io.Copy(z, r); err == nil {
+		err = z.Close()
+	}
+	return
+}
+
+func decompress(w io.Writer, r io.Reader) (n int64, err error) {
+	if *raw {
+		z := funlz.NewReader(r)
+		/* Close of compress ends stream with flush mark */
+		z.SetStrict(true)
+		if n, err = io.Copy(w, z); err == nil {
+			err = z.Close()
+		}
+		return
+	}
+	z, err := funlz.NewFrameReader(r)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = io.Copy(w, z); err == nil {
+		err = z.Close()
+	}
+	return
+}
+
+/* validate checks raw stream without decompressing it, as strict Reader does */
+func validate(r io.Reader) (int64, error) {
+	res, err := funlz.Validate(r)
+	if err == nil && !res.Complete {
+		err = &funlz.TruncatedError{Offset: res.Compressed}
+	}
+	return res.Uncompressed, err
+}
+
+func decompressFile(name string) (err error) {
+	outName := strings.TrimSuffix(name, *suffix)
+	if name != "-" && !*stdout && outName == name {
+		return fmt.Errorf("unknown suffix, expected %s", *suffix)
+	}
+	in, size, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createOutput(name, outName)
+	if err != nil {
+		return err
+	}
+	n, err := decompress(out.w, bufio.NewReader(in))
+	if err = out.close(err); err != nil {
+		return err
+	}
+	report(name, n, size)
+	return finish(name)
+}
+
+func testFile(name string) error {
+	in, size, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var n int64
+	if *raw {
+		n, err = validate(bufio.NewReader(in))
+	} else {
+		n, err = decompress(ioutil.Discard, bufio.NewReader(in))
+	}
+	if err != nil {
+		return err
+	}
+	report(name, n, size)
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "%s:\tOK\n", name)
+	}
+	return nil
+}
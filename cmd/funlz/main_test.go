@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/funny-falcon/go-funlz"
+)
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	orig, err := ioutil.ReadFile("../../GettingReal.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "a.html")
+	if err = ioutil.WriteFile(name, orig, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = compressFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("input is not removed: %v", err)
+	}
+	if err = compressFile(name + ".flz"); err == nil {
+		t.Errorf("compressed twice")
+	}
+	if err = testFile(name + ".flz"); err != nil {
+		t.Errorf("test: %v", err)
+	}
+	*keep = true
+	defer func() { *keep = false }()
+	if err = decompressFile(name + ".flz"); err != nil {
+		t.Fatal(err)
+	}
+	if err = decompressFile(name + ".flz"); err == nil {
+		t.Errorf("output overwritten without -f")
+	}
+	d, _ := ioutil.ReadFile(name)
+	if !bytes.Equal(orig, d) {
+		t.Errorf("decompressed differs")
+	}
+	if err = decompressFile(name); err == nil {
+		t.Errorf("decompressed file without suffix")
+	}
+	c, _ := ioutil.ReadFile(name + ".flz")
+	c[len(c)/2] ^= 1
+	ioutil.WriteFile(name+".flz", c, 0640)
+	if err = testFile(name + ".flz"); err == nil {
+		t.Errorf("test of corrupted file: no error")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	*raw = true
+	defer func() { *raw = false }()
+	var c, d bytes.Buffer
+	if _, err := compress(&c, bytes.NewBufferString("hello hello hello"), -1); err != nil {
+		t.Fatal(err)
+	}
+	stream := append([]byte(nil), c.Bytes()...)
+	if _, err := decompress(&d, &c); err != nil || d.String() != "hello hello hello" {
+		t.Errorf("raw round trip: %q %v", d.String(), err)
+	}
+	if n, err := validate(bytes.NewReader(stream)); err != nil || n != 17 {
+		t.Errorf("validate: %d %v", n, err)
+	}
+	if _, err := validate(bytes.NewReader(stream[:len(stream)-1])); err == nil {
+		t.Errorf("validate of stream without flush mark: no error")
+	}
+}
+
+func TestDump(t *testing.T) {
+	var c, out bytes.Buffer
+	if _, err := compress(&c, bytes.NewBufferString("hello hello hello"), 17); err != nil {
+		t.Fatal(err)
+	}
+	frame := c.Bytes()
+	d := &dumper{w: &out, n: 32}
+	if err := d.frame(bufio.NewReader(bytes.NewReader(frame)), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"content size 17", `literal        6       "hello "`, `copy          11    6  "hello hello"`, "flush",
+		"-- segment 1: 3 tokens, 1 literals (6 bytes), 1 copies (11 bytes)", "trailer at 24: uncompressed 17"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("no %q in dump:\n%s", s, out.String())
+		}
+	}
+	out.Reset()
+	d = &dumper{w: &out, n: 32}
+	if err := d.tokens(funlz.NewTokenReader(bytes.NewReader(frame[:len(frame)-3])), 0, 0); err == nil {
+		t.Errorf("no error for frame dumped as raw stream:\n%s", out.String())
+	}
+	/* offset of error is in whole frame */
+	d = &dumper{w: &out, n: 32}
+	err := d.frame(bufio.NewReader(bytes.NewReader([]byte("FnLZ\x01\x00\x03\x05\x05ab"))), nil)
+	if te, ok := err.(*funlz.TruncatedError); !ok || te.Offset != 8 {
+		t.Errorf("expected truncated at 8, got %v", err)
+	}
+}
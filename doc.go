@@ -3,6 +3,23 @@ funlz - compression and decompression library
 
 Writer and Reader - streaming compressor/decompressor without framing.
 
+Compress and Decompress - one-shot compression of slices into the same format.
+
+Writer.WriteMessage and Reader.ReadMessage - messages delimited by flush marks.
+
+TokenReader - token by token decoding for inspection of streams.
+
+Validate - fast check of stream without decoding of data.
+
+Reader.SetRecovery - skipping of corrupt segments of streams written with Flush.
+
+Reader.SetLimits - protection from decompression bombs.
+
+FrameWriter and FrameReader - optional framing with magic, content size and
+checksumed segments around the same token stream. Segments could be Huffman
+coded for better compression, or stored as is if they are incompressible.
+Trailer written by Close tells reader that frame is complete.
+
 Format is derived from lzf but window reduced to 4096 bytes and short copy limit is 16 bytes
 	flush mark
 		[0]
@@ -15,9 +32,11 @@ Format is derived from lzf but window reduced to 4096 bytes and short copy limit
 	big copy len=17..272 offset=1..4096 l=len-2 off=offset-1:
 		[0xf0 | off>>8] [off&0xff] [l-17]
 
-For performance reason, tunable parameters are constants and not exposed.
-So you encouraged to copy this library to your project and tune them.
-All tunable params and functions are in doc.go .
+For performance reason, default tunable parameters are constants.
+They could be changed at runtime with Options or compression level passed
+to NewWriterOptions or NewWriterLevel, but fixed size hash table of defaults
+is a bit faster. So you still may copy this library to your project and tune
+constants. All tunable params and functions are in doc.go .
 
 */
 package funlz
@@ -31,7 +50,6 @@ const (
 	hashlog = 11
 	// backref is number of elements for each hash bucket.
 	// lesser backref - faster compression but lesser compression ratio
-	// if you change backref, then change (*positions).push accordantly
 	// backref/hashlog==1/11 usualy gives same compression ratio size as 2/9, but faster
 	// backref/hashlog==4/12 gives good compression ratio, but it is slow
 	// Sizeof(hash) == 4*backref*pow(2, hashlog). If it is more than half of L1 CPU cache, compression can be slow.
@@ -45,14 +63,13 @@ const (
 /* size of positions could be increased to accieve more compression */
 type positions [backref]int32
 
-/* you should fix this function accordantly to backref value */
+/* push shifts older positions and puts u first, it works for any backref */
 func (p *positions) push(u int32) {
-	//p[7] = p[6]
-	//p[6] = p[5]
-	//p[5] = p[4]
-	//p[4] = p[3]
-	//p[3] = p[2]
-	//p[2] = p[1]
-	//p[1] = p[0]
+	pushPos(p[:], u)
+}
+
+/* pushPos shifts older positions of bucket p and puts u first, hashTable uses it too */
+func pushPos(p []int32, u int32) {
+	copy(p[1:], p)
 	p[0] = u
 }
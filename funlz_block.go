@@ -0,0 +1,123 @@
+package funlz
+
+/* appendWriter is a writeAndByteWriter which appends to slice and never fails */
+type appendWriter struct {
+	b []byte
+}
+
+func (a *appendWriter) Write(b []byte) (int, error) {
+	a.b = append(a.b, b...)
+	return len(b), nil
+}
+
+func (a *appendWriter) WriteByte(b byte) error {
+	a.b = append(a.b, b)
+	return nil
+}
+
+// MaxCompressedLen returns upper bound of Compress output for n bytes of input.
+func MaxCompressedLen(n int) int {
+	/* each maxLit literal costs 2 bytes of header, copies never expand,
+	   and every wrapsize segment ends with flush mark */
+	return n + 2*(n/maxLit+1) + n/wrapsize + 1
+}
+
+/*
+Compress appends compressed src to dst and returns resulting slice.
+Output is the same token stream as Writer produces for single Write and Flush,
+so it could be read with Reader as well as with Decompress.
+If dst has not enough capacity for MaxCompressedLen(len(src)), it is grown once.
+
+	buf = funlz.Compress(buf[:0], message)
+*/
+func Compress(dst, src []byte) []byte {
+	if need := len(dst) + MaxCompressedLen(len(src)); cap(dst) < need {
+		ndst := make([]byte, len(dst), need)
+		copy(ndst, dst)
+		dst = ndst
+	}
+	aw := appendWriter{b: dst}
+	e := &encoder{wire: wireSink{w: &aw}}
+	e.sink = &e.wire
+	e.setOptions(Options{})
+	for {
+		l := len(src)
+		if l > wrapsize {
+			l = wrapsize
+		}
+		/* appendWriter never fails, so errors are not checked */
+		upos, _ := e.compress(src[:l], -1, 0, int32(l))
+		e.finish(src[:l], -1, upos)
+		src = src[l:]
+		if len(src) == 0 {
+			break
+		}
+		e.reset()
+	}
+	return aw.b
+}
+
+/*
+Decompress appends decompressed src to dst and returns resulting slice.
+src should contain whole token stream, for example produced by Compress or
+by Writer followed by Flush. Back references are checked to not point before
+start of appended data, so bytes already in dst are never copied.
+*/
+func Decompress(dst, src []byte) ([]byte, error) {
+	return decode(dst, src, len(dst), false)
+}
+
+/*
+decode appends decompressed src to dst, copies could refer to dst[base:].
+src of segment should end with flush mark, and should have no other.
+*/
+func decode(dst, src []byte, base int, segment bool) ([]byte, error) {
+	flushed := false
+	for i := 0; i < len(src); {
+		start := i
+		tag := src[i]
+		/* header is at most 3 bytes, its length is checked after parsing */
+		var b1, b2 byte
+		if len(src)-i > 2 {
+			b1, b2 = src[i+1], src[i+2]
+		} else if len(src)-i > 1 {
+			b1 = src[i+1]
+		}
+		l, off, n := parseHeader(tag, b1, b2)
+		if len(src)-i < n || off == 0 && len(src)-i-n < int(l) {
+			if segment {
+				/* segment length is known, so segment ended inside of token is corrupt */
+				return dst, &CorruptError{Offset: int64(start)}
+			}
+			return dst, &TruncatedError{Offset: int64(start)}
+		}
+		i += n
+		if off == 0 {
+			/* literal or flush mark */
+			if l == 0 && segment {
+				if i != len(src) {
+					return dst, &CorruptError{Offset: int64(start)}
+				}
+				flushed = true
+			}
+			dst = append(dst, src[i:i+int(l)]...)
+			i += int(l)
+			continue
+		}
+		if int(off) > len(dst)-base {
+			return dst, &CorruptError{Offset: int64(start)}
+		}
+		f := len(dst) - int(off)
+		/* overlapped copy: repeat already copied part doubling it */
+		for off < l {
+			dst = append(dst, dst[f:f+int(off)]...)
+			l -= off
+			off *= 2
+		}
+		dst = append(dst, dst[f:f+int(l)]...)
+	}
+	if segment && !flushed {
+		return dst, &CorruptError{Offset: int64(len(src))}
+	}
+	return dst, nil
+}
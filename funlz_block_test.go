@@ -0,0 +1,104 @@
+package funlz
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+Loop:
+	for _, p := range patterns {
+		o := Compress(nil, p[0])
+		for _, c := range p[1:] {
+			if eq(c, o) == -1 {
+				continue Loop
+			}
+		}
+		t.Errorf("not equal to Writer output\n%#v", o)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	for _, p := range patterns {
+		o, err := Decompress(nil, p[1])
+		if err != nil {
+			t.Errorf("decompress %q: %v", p[0], err)
+		}
+		if eq(p[0], o) != -1 {
+			t.Errorf("not equal\n%#v\n%#v", p[0], o)
+		}
+	}
+}
+
+func TestBlockBigFile(t *testing.T) {
+	c := Compress(nil, original)
+	if len(c) > MaxCompressedLen(len(original)) {
+		t.Errorf("compressed %d more than bound %d", len(c), MaxCompressedLen(len(original)))
+	}
+	if p := eq(original, decompress(c)); p != -1 {
+		t.Errorf("Reader could not read Compress output at %d", p)
+	}
+	d, err := Decompress(nil, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := eq(original, d); p != -1 {
+		t.Errorf("Decompress could not read Writer output at %d", p)
+	}
+}
+
+func TestBlockAppend(t *testing.T) {
+	prefix := []byte("prefix")
+	c := Compress(prefix, original[:11111])
+	if string(c[:len(prefix)]) != "prefix" {
+		t.Errorf("Compress damaged dst")
+	}
+	d, err := Decompress(prefix, c[len(prefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d[:len(prefix)]) != "prefix" || eq(original[:11111], d[len(prefix):]) != -1 {
+		t.Errorf("Decompress damaged or misplaced output")
+	}
+}
+
+func TestBlockIncompressible(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 30, 31, 286, 287, 289, 290, 4097, 100000} {
+		b := make([]byte, n)
+		rnd.Read(b)
+		c := Compress(nil, b)
+		if len(c) > MaxCompressedLen(n) {
+			t.Errorf("%d: compressed %d more than bound %d", n, len(c), MaxCompressedLen(n))
+		}
+		d, err := Decompress(nil, c)
+		if err != nil || eq(b, d) != -1 {
+			t.Errorf("%d: round trip failed: %v", n, err)
+		}
+		if eq(b, decompress(compress(b))) != -1 {
+			t.Errorf("%d: Writer round trip failed", n)
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	for _, c := range []string{"\x02a", "\x1f", "\x20", "\xf0\x00", "\x01a\x20\x01"} {
+		if _, err := Decompress(nil, []byte(c)); err == nil {
+			t.Errorf("%#v: no error", c)
+		}
+	}
+}
+
+func BenchmarkBlockCompressBig(b *testing.B) {
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		dst = Compress(dst[:0], original)
+	}
+}
+
+func BenchmarkBlockDecompressBig(b *testing.B) {
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		dst, _ = Decompress(dst[:0], compressed)
+	}
+}
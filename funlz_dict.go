@@ -0,0 +1,84 @@
+package funlz
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+/*
+Dictionary is a preset history for Writer and Reader.
+Writer and Reader put it before data at start and after every flush,
+so copies could refer to dictionary bytes. Writer and Reader should use
+same Dictionary, ID helps to check it.
+
+	dict := funlz.NewDictionary(sample)
+	comp := funlz.NewWriterDict(my_sock, dict)
+	decomp := funlz.NewReaderDict(peer_sock, dict)
+*/
+type Dictionary struct {
+	id   uint32
+	data []byte
+	last uint32              /* last 4 chars of data */
+	hash [hashsize]positions /* positions of data for default Options */
+}
+
+// NewDictionary makes Dictionary from last 4096 bytes of data.
+// Most frequent substrings should be placed at the end of data.
+func NewDictionary(data []byte) *Dictionary {
+	if len(data) > window {
+		data = data[len(data)-window:]
+	}
+	d := &Dictionary{data: append([]byte(nil), data...)}
+	d.id = crc32.Checksum(d.data, castagnoli)
+	e := encoder{}
+	e.setOptions(Options{})
+	e.prime(d.data)
+	d.hash = e.hash
+	d.last = e.last
+	return d
+}
+
+// ID returns crc32c checksum of dictionary bytes
+func (d *Dictionary) ID() uint32 {
+	return d.id
+}
+
+// Bytes returns dictionary content. It should not be modified.
+func (d *Dictionary) Bytes() []byte {
+	return d.data
+}
+
+// NewWriterDict wraps io.Writer into Writer with preset dictionary
+func NewWriterDict(wr io.Writer, d *Dictionary) *Writer {
+	w, _ := NewWriterOptions(wr, Options{Dict: d})
+	return w
+}
+
+// NewReaderDict wraps io.Reader into Reader with preset dictionary
+func NewReaderDict(rd io.Reader, d *Dictionary) *Reader {
+	r := &Reader{dict: d}
+	r.Reset(rd)
+	return r
+}
+
+/* prime puts positions of raw into hash as if it were compressed */
+func (e *encoder) prime(raw []byte) {
+	last := e.last
+	for i, c := range raw {
+		last = (last << 8) | uint32(c)
+		if i+1 >= minCopy {
+			e.insert(raw, -1, int32(i+1), int32(len(raw)), last, (last*somemagicconst)>>e.shift)
+		}
+	}
+	e.last = last
+}
+
+/* primeDict expects cleared encoder */
+func (e *encoder) primeDict(d *Dictionary) {
+	if e.tab.table == nil && e.finder == nil {
+		e.hash = d.hash
+		e.last = d.last
+		return
+	}
+	e.prime(d.data)
+}
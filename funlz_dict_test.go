@@ -0,0 +1,93 @@
+package funlz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDict(t *testing.T) {
+	var dictMessages [][]byte
+	for i := 0; i < 20; i++ {
+		p := 20000 + i*700
+		dictMessages = append(dictMessages, original[p:p+300+i*10])
+	}
+	dict := NewDictionary(original[15000:40000])
+	opts := []Options{{Dict: dict}, {HashLog: 12, BackRef: 4, Dict: dict}}
+	for _, o := range opts {
+		var plain, withDict bytes.Buffer
+		c := NewWriter(&plain)
+		cd, _ := NewWriterOptions(&withDict, o)
+		for _, m := range dictMessages {
+			c.Write(m)
+			c.Flush()
+			cd.Write(m)
+			cd.Flush()
+		}
+		if withDict.Len() >= plain.Len() {
+			t.Errorf("%d/%d: dictionary doesn't help %d >= %d", o.HashLog, o.BackRef, withDict.Len(), plain.Len())
+		}
+		d := NewReaderDict(bytes.NewReader(withDict.Bytes()), dict)
+		for i, m := range dictMessages {
+			o := make([]byte, len(m))
+			for j := range o {
+				o[j], _ = d.ReadByte()
+			}
+			if eq(m, o) != -1 {
+				t.Errorf("message %d differs", i)
+			}
+		}
+		all, _ := ioutil.ReadAll(NewReaderDict(bytes.NewReader(withDict.Bytes()), dict))
+		if eq(bytes.Join(dictMessages, nil), all) != -1 {
+			t.Errorf("Read differs")
+		}
+	}
+}
+
+func TestDictBig(t *testing.T) {
+	dict := NewDictionary(original[:4096])
+	var out bytes.Buffer
+	c := NewWriterDict(&out, dict)
+	c.Write(original)
+	c.Flush()
+	all, _ := ioutil.ReadAll(NewReaderDict(&out, dict))
+	if p := eq(original, all); p != -1 {
+		t.Errorf("not equal at %d", p)
+	}
+}
+
+func TestFrameDict(t *testing.T) {
+	dict := NewDictionary(original[15000:40000])
+	c := frameCompress(original, FrameOptions{Options: Options{Dict: dict}, Checksum: true})
+	if _, err := NewFrameReader(bytes.NewReader(c)); err != ErrDictionary {
+		t.Errorf("no dictionary: %v", err)
+	}
+	if _, err := NewFrameReaderDict(bytes.NewReader(c), NewDictionary(original[:100])); err != ErrDictionary {
+		t.Errorf("wrong dictionary: %v", err)
+	}
+	f, err := NewFrameReaderDict(bytes.NewReader(c), dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(f)
+	if err != nil || eq(original, d) != -1 {
+		t.Errorf("not equal: %v", err)
+	}
+}
+
+func TestDictFlushSync(t *testing.T) {
+	dict := NewDictionary(original[15000:40000])
+	var sync, full bytes.Buffer
+	cs := NewWriterDict(&sync, dict)
+	cf := NewWriterDict(&full, dict)
+	for i := 0; i < 10; i++ {
+		m := original[30000+i*200 : 30000+i*200+150]
+		cs.Write(m)
+		cs.FlushSync()
+		cf.Write(m)
+		cf.FlushFull()
+	}
+	if p := eq(full.Bytes(), sync.Bytes()); p != -1 {
+		t.Errorf("FlushSync with dictionary differs from FlushFull at %d", p)
+	}
+}
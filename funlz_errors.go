@@ -0,0 +1,85 @@
+package funlz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+Errors of package are values to compare with errors.Is. Errors which have
+position are returned as pointers to types below, and errors.Is(err, ErrXxx)
+reports them as well:
+
+	_, err := decomp.Read(buf)
+	var ce *funlz.CorruptError
+	if errors.As(err, &ce) {
+		log.Printf("bad token at %d", ce.Offset)
+	}
+
+Errors of underlying io.Reader and io.Writer are returned as is.
+*/
+var (
+	// ErrCorrupt is returned when compressed input is malformed, see CorruptError
+	ErrCorrupt = errors.New("funlz: corrupt input")
+	// ErrTruncated is returned when compressed input ends inside of token or message,
+	// see TruncatedError. errors.Is(err, io.ErrUnexpectedEOF) reports it too.
+	ErrTruncated = errors.New("funlz: truncated input")
+	// ErrClosed is returned by Writer and Reader methods called after Close
+	ErrClosed = errors.New("funlz: use of closed stream")
+	// ErrTooLarge is returned when data exceeds limit, see TooLargeError
+	ErrTooLarge = errors.New("funlz: data is too large")
+)
+
+// CorruptError reports malformed token at compressed byte Offset
+type CorruptError struct {
+	Offset int64
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("funlz: corrupt input at offset %d", e.Offset)
+}
+
+// Is makes errors.Is(err, ErrCorrupt) true
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// TruncatedError reports that input ended inside of token started at compressed byte Offset
+type TruncatedError struct {
+	Offset int64
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("funlz: input truncated at offset %d", e.Offset)
+}
+
+// Is makes errors.Is(err, ErrTruncated) and errors.Is(err, io.ErrUnexpectedEOF) true
+func (e *TruncatedError) Is(target error) bool {
+	return target == ErrTruncated || target == io.ErrUnexpectedEOF
+}
+
+// TooLargeError reports that data exceeds Limit. Offset is a position of
+// failed operation: compressed one for readers and uncompressed one for writers,
+// or -1 if it is unknown.
+type TooLargeError struct {
+	Offset int64
+	Limit  int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("funlz: data exceeds limit %d at offset %d", e.Limit, e.Offset)
+}
+
+// Is makes errors.Is(err, ErrTooLarge) true
+func (e *TooLargeError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+/* truncated converts end of input inside of token started at pos */
+func truncated(err error, pos int64) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &TruncatedError{Offset: pos}
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+/* failWriter accepts n bytes and fails after */
+type failWriter struct {
+	n int
+}
+
+var errFail = errors.New("write failed")
+
+func (f *failWriter) Write(b []byte) (int, error) {
+	if len(b) > f.n {
+		n := f.n
+		f.n = 0
+		return n, errFail
+	}
+	f.n -= len(b)
+	return len(b), nil
+}
+
+func TestWriterFlushError(t *testing.T) {
+	for _, flush := range []func(*Writer) error{(*Writer).FlushFull, (*Writer).FlushSync, (*Writer).Close} {
+		w := NewWriter(&failWriter{n: 10})
+		if _, err := w.Write(original[:1000]); err != nil {
+			t.Fatal(err)
+		}
+		if err := flush(w); err != errFail {
+			t.Errorf("flush: %v", err)
+		}
+		if _, err := w.Write(original[:10]); err != errFail {
+			t.Errorf("write after failed flush: %v", err)
+		}
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	c := compress(original[:11111])
+	for _, cut := range []int{1, 2, 3, 50} {
+		tr := NewTokenReader(bytes.NewReader(c))
+		var pos int64
+		for {
+			tok, err := tr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.Pos+int64(cut) >= int64(len(c)) {
+				break
+			}
+			pos = tok.Pos
+		}
+		/* cut stream inside of token started at pos */
+		d, err := ioutil.ReadAll(NewReader(bytes.NewReader(c[:pos+1])))
+		var te *TruncatedError
+		if !errors.As(err, &te) || te.Offset != pos || !errors.Is(err, ErrTruncated) {
+			t.Errorf("cut at %d: %v", pos+1, err)
+		}
+		if eq(original[:len(d)], d) != -1 {
+			t.Errorf("cut at %d: decoded data differs", pos+1)
+		}
+		if _, err = Decompress(nil, c[:pos+1]); !errors.As(err, &te) || te.Offset != pos {
+			t.Errorf("Decompress cut at %d: %v", pos+1, err)
+		}
+	}
+}
+
+func TestClosed(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("Write after Close: %v", err)
+	}
+	if err := w.WriteByte('x'); err != ErrClosed {
+		t.Errorf("WriteByte after Close: %v", err)
+	}
+	if err := w.Flush(); err != ErrClosed {
+		t.Errorf("Flush after Close: %v", err)
+	}
+	w.Reset(ioutil.Discard)
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Errorf("Write after Reset: %v", err)
+	}
+
+	r := NewReader(bytes.NewReader(out.Bytes()))
+	if b, err := r.ReadByte(); err != nil || b != 'h' {
+		t.Fatal(b, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 10)); err != ErrClosed {
+		t.Errorf("Read after Close: %v", err)
+	}
+	if _, err := r.ReadByte(); err != ErrClosed {
+		t.Errorf("ReadByte after Close: %v", err)
+	}
+	if _, err := r.ReadMessage(); err != ErrClosed {
+		t.Errorf("ReadMessage after Close: %v", err)
+	}
+
+	f := NewFrameWriter(&out)
+	f.Close()
+	if _, err := f.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("FrameWriter Write after Close: %v", err)
+	}
+	fr, _ := NewFrameReader(bytes.NewReader(frameCompress(original[:100], FrameOptions{})))
+	fr.Read(make([]byte, 10))
+	fr.Close()
+	if _, err := fr.Read(make([]byte, 10)); err != ErrClosed {
+		t.Errorf("FrameReader Read after Close: %v", err)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	var out bytes.Buffer
+	f, _ := NewFrameWriterOptions(&out, FrameOptions{HasContentSize: true, ContentSize: 10})
+	f.Write(make([]byte, 5))
+	_, err := f.Write(make([]byte, 6))
+	if te, ok := err.(*TooLargeError); !ok || te.Offset != 5 || te.Limit != 10 || !errors.Is(err, ErrTooLarge) {
+		t.Errorf("frame: %v", err)
+	}
+	w := NewWriter(&out)
+	if err = w.WriteMessage(make([]byte, MaxMessageSize+1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("message: %v", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.Write(original[:1000])
+	w.FlushSync()
+	w.Write(original[1000:2000])
+	w.Close()
+	c := out.Bytes()
+	r := NewReader(bytes.NewReader(c))
+	r.SetStrict(true)
+	if d, err := ioutil.ReadAll(r); err != nil || eq(original[:2000], d) != -1 {
+		t.Errorf("complete stream: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close of complete stream: %v", err)
+	}
+	r.Reset(bytes.NewReader(nil))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Errorf("empty stream: %v", err)
+	}
+	/* cut at token boundary */
+	tr := NewTokenReader(bytes.NewReader(c))
+	prev := FlushMark
+	for {
+		tok, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind == FlushMark {
+			prev = tok.Kind
+			continue
+		}
+		r.Reset(bytes.NewReader(c[:tok.Pos]))
+		d, err := ioutil.ReadAll(r)
+		if prev == FlushMark {
+			/* cut after flush mark is a complete stream */
+			if err != nil {
+				t.Errorf("cut after flush mark at %d: %v", tok.Pos, err)
+			}
+		} else if te, ok := err.(*TruncatedError); !ok || te.Offset != tok.Pos || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("cut at %d: %v", tok.Pos, err)
+		} else if err = r.Close(); err == nil {
+			t.Errorf("cut at %d: Close reports no error", tok.Pos)
+		}
+		if eq(original[:len(d)], d) != -1 {
+			t.Errorf("cut at %d: decoded data differs", tok.Pos)
+		}
+		if tok.Pos > 1000 {
+			break
+		}
+		prev = tok.Kind
+	}
+	/* without strict mode cut at token boundary is not detected */
+	r = NewReader(bytes.NewReader(c[:len(c)-1]))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Errorf("not strict: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package funlz
+
+/*
+MatchFinder looks for earlier occurrences of input for Writer.
+
+Input is addressed as data[i&mask]. Position pos stands for 4 bytes
+data[pos-4:pos], seq keeps them in big endian order, so candidates are
+positions p where data[p-4:p] may be equal to data[pos-4:pos].
+Bytes up to end are available, positions before pos-4096 are useless.
+Writer checks every candidate, so finder may return false ones.
+Find and Insert are called with non decreasing pos.
+
+Writer uses hash buckets of Options.HashLog and Options.BackRef if
+Options.Finder is nil. NewHashFinder, NewHashChain and NewBinaryTree
+make finders for Options.Finder:
+
+	o := funlz.Options{Finder: func() funlz.MatchFinder { return funlz.NewHashChain(14, 32) }}
+*/
+type MatchFinder interface {
+	// Reset forgets all positions.
+	Reset()
+	// Find returns candidates for pos, best ones first. Returned slice is
+	// valid until next call. Find is followed by Insert of the same pos.
+	Find(data []byte, mask, pos, end int32, seq uint32) []int32
+	// Insert remembers pos.
+	Insert(data []byte, mask, pos, end int32, seq uint32)
+}
+
+/* hashTable keeps backref positions for each of hash buckets */
+type hashTable struct {
+	shift   uint32  /* 32 - hashlog */
+	backref int32   /* bucket size in table */
+	table   []int32 /* hash of positions if not default hashlog/backref */
+}
+
+// NewHashFinder returns MatchFinder with pow(2,hashLog) buckets of backRef
+// recent positions. It is the finder Writer uses by default.
+func NewHashFinder(hashLog, backRef int) MatchFinder {
+	return &hashTable{
+		shift:   uint32(32 - hashLog),
+		backref: int32(backRef),
+		table:   make([]int32, backRef<<uint(hashLog)),
+	}
+}
+
+// bucket returns positions stored for hash h, most recent first
+func (t *hashTable) bucket(h uint32) []int32 {
+	i := int32(h) * t.backref
+	return t.table[i : i+t.backref]
+}
+
+// push stores position u into bucket for hash h
+func (t *hashTable) push(h uint32, u int32) {
+	pushPos(t.bucket(h), u)
+}
+
+func (t *hashTable) Reset() {
+	for i := range t.table {
+		t.table[i] = 0
+	}
+}
+
+func (t *hashTable) Find(data []byte, mask, pos, end int32, seq uint32) []int32 {
+	return t.bucket((seq * somemagicconst) >> t.shift)
+}
+
+func (t *hashTable) Insert(data []byte, mask, pos, end int32, seq uint32) {
+	t.push((seq*somemagicconst)>>t.shift, pos)
+}
+
+/* hashChain links every position to previous one with same hash */
+type hashChain struct {
+	shift uint32
+	depth int32
+	head  []int32
+	prev  [window]int32 /* previous position indexed by pos%window */
+	cand  []int32
+}
+
+// NewHashChain returns MatchFinder which keeps all positions of last 4096
+// bytes in chains of pow(2,hashLog) buckets and returns up to depth of them.
+func NewHashChain(hashLog, depth int) MatchFinder {
+	return &hashChain{
+		shift: uint32(32 - hashLog),
+		depth: int32(depth),
+		head:  make([]int32, 1<<uint(hashLog)),
+		cand:  make([]int32, 0, depth),
+	}
+}
+
+func (c *hashChain) Reset() {
+	for i := range c.head {
+		c.head[i] = 0
+	}
+}
+
+func (c *hashChain) Find(data []byte, mask, pos, end int32, seq uint32) []int32 {
+	wind := pos - window
+	cand := c.cand[:0]
+	/* position out of window could not be overwritten by newer one */
+	for p, d := c.head[(seq*somemagicconst)>>c.shift], c.depth; d != 0 && p-minCopy >= wind && p > 0; d-- {
+		cand = append(cand, p)
+		p = c.prev[p%window]
+	}
+	c.cand = cand
+	return cand
+}
+
+func (c *hashChain) Insert(data []byte, mask, pos, end int32, seq uint32) {
+	h := (seq * somemagicconst) >> c.shift
+	c.prev[pos%window] = c.head[h]
+	c.head[h] = pos
+}
+
+/*
+binaryTree keeps positions with same hash in binary search tree ordered
+by bytes following them, as lzma's bt4 does. Search descends to position
+where new one is inserted, so it visits longest matches on its way.
+*/
+type binaryTree struct {
+	shift uint32
+	depth int32
+	head  []int32
+	left  [window]int32 /* children indexed by pos%window */
+	right [window]int32
+	next  int32 /* next position to insert */
+	found [4]struct {
+		pos  int32
+		cand []int32
+	} /* candidates of recently inserted positions */
+}
+
+// NewBinaryTree returns MatchFinder which keeps positions of last 4096 bytes
+// in binary trees of pow(2,hashLog) buckets and visits up to depth nodes.
+// It is slower than hash chain, but finds longer matches with same depth.
+func NewBinaryTree(hashLog, depth int) MatchFinder {
+	t := &binaryTree{
+		shift: uint32(32 - hashLog),
+		depth: int32(depth),
+		head:  make([]int32, 1<<uint(hashLog)),
+	}
+	for i := range t.found {
+		t.found[i].cand = make([]int32, 0, depth)
+	}
+	return t
+}
+
+func (t *binaryTree) Reset() {
+	for i := range t.head {
+		t.head[i] = 0
+	}
+	for i := range t.found {
+		t.found[i].pos = 0
+	}
+	t.next = 0
+}
+
+func (t *binaryTree) Find(data []byte, mask, pos, end int32, seq uint32) []int32 {
+	if pos >= t.next {
+		t.insert(data, mask, pos, end, seq)
+	}
+	/* lazy matching looks ahead, so candidates are kept for some positions */
+	if f := &t.found[pos&3]; f.pos == pos {
+		return f.cand
+	}
+	return nil
+}
+
+func (t *binaryTree) Insert(data []byte, mask, pos, end int32, seq uint32) {
+	if pos >= t.next {
+		t.insert(data, mask, pos, end, seq)
+	}
+}
+
+func (t *binaryTree) insert(data []byte, mask, pos, end int32, seq uint32) {
+	f := &t.found[pos&3]
+	f.pos = pos
+	cand := f.cand[:0]
+	t.next = pos + 1
+
+	h := (seq * somemagicconst) >> t.shift
+	cur := t.head[h]
+	t.head[h] = pos
+	s := pos - minCopy
+	wind := pos - window
+	max := end - s
+	if max > maxCopy {
+		max = maxCopy
+	}
+	pl, pr := &t.left[pos%window], &t.right[pos%window]
+	var ll, lr int32
+	for d := t.depth; d != 0 && cur > 0 && cur-minCopy >= wind; d-- {
+		c := cur - minCopy
+		l := ll
+		if lr < l {
+			l = lr
+		}
+		for l < max && data[(c+l)&mask] == data[(s+l)&mask] {
+			l++
+		}
+		cand = append(cand, cur)
+		if l == max {
+			/* cur is replaced with pos */
+			*pl, *pr = t.left[cur%window], t.right[cur%window]
+			f.cand = cand
+			return
+		}
+		if data[(c+l)&mask] < data[(s+l)&mask] {
+			*pl = cur
+			pl = &t.right[cur%window]
+			cur = *pl
+			ll = l
+		} else {
+			*pr = cur
+			pr = &t.left[cur%window]
+			cur = *pr
+			lr = l
+		}
+	}
+	*pl, *pr = 0, 0
+	f.cand = cand
+}
@@ -0,0 +1,72 @@
+package funlz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestHashFinder(t *testing.T) {
+	o := Options{Finder: func() MatchFinder { return NewHashFinder(12, 4) }}
+	if p := eq(compressOptions(original, Options{HashLog: 12, BackRef: 4}), compressOptions(original, o)); p != -1 {
+		t.Errorf("NewHashFinder differs from Options at %d", p)
+	}
+}
+
+func TestFinders(t *testing.T) {
+	finders := map[string]func() MatchFinder{
+		"chain":  chainFinder(12, 8),
+		"chain1": chainFinder(minHashLog, 1),
+		"tree":   treeFinder(12, 8),
+		"tree1":  treeFinder(minHashLog, 1),
+	}
+	opts := []Options{{}, {HashCopy: true, LookBehind: true}, {Lazy: 2}, {Optimal: true}}
+	dict := NewDictionary(original[len(original)-5000:])
+	for name, f := range finders {
+		for _, o := range opts {
+			o.Finder = f
+			c := compressOptions(original, o)
+			if p := eq(original, decompress(c)); p != -1 {
+				t.Errorf("%s %+v: not equal at %d", name, o, p)
+			}
+			t.Logf("%s %+v: orig/comp %d/%d", name, o, len(original), len(c))
+
+			/* short writes with sync flushes and dictionary */
+			var out bytes.Buffer
+			o.Dict = dict
+			w, _ := NewWriterOptions(&out, o)
+			for i := 0; i < len(original); i += 777 {
+				j := i + 777
+				if j > len(original) {
+					j = len(original)
+				}
+				w.Write(original[i:j])
+				if i%7 == 0 {
+					w.FlushSync()
+				}
+			}
+			w.Close()
+			d, err := ioutil.ReadAll(NewReaderDict(bytes.NewReader(out.Bytes()), dict))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p := eq(original, d); p != -1 {
+				t.Errorf("%s %+v: with dictionary not equal at %d", name, o, p)
+			}
+		}
+	}
+}
+
+func BenchmarkCompressBigChain(b *testing.B) {
+	o := Options{Finder: chainFinder(14, 16)}
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, o)
+	}
+}
+
+func BenchmarkCompressBigTree(b *testing.B) {
+	o := Options{Finder: treeFinder(14, 16)}
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, o)
+	}
+}
@@ -0,0 +1,589 @@
+package funlz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+/*
+Frame format wraps Writer token stream into segments which could be checked:
+
+	header
+		[magic "FnLZ"] [version] [flags] + <uvarint content size if flags&frameSize>
+		+ <dictionary ID, little endian, if flags&frameDict>
+	segment, one per flush
+		<uvarint compressed len> <uvarint uncompressed len>
+		+ <segment type, if flags&frameTyped>
+		+ <crc32c of uncompressed bytes, little endian, if flags&frameChecksum>
+		+ <compressed len bytes of tokens ended with flush mark, or segment of type>
+	trailer, since version 2, written by Close
+		[0] <uvarint uncompressed len of frame>
+
+Segment types are SegmentTokens, which is the same as untyped segment,
+SegmentHuffman, see funlz_huffman.go, and SegmentStored, which keeps
+uncompressed bytes as is, so compressed len is equal to uncompressed one.
+
+Every segment is compressed from clear state, so it is decodable by itself
+(given the dictionary, if it was used). Compressed len of segment is never 0,
+so trailer is distinct from segments. FrameReader reads version 1 frames,
+which have no trailer and end at end of input.
+*/
+const (
+	frameMagic    = "FnLZ"
+	frameVersion  = 2
+	frameVersion1 = 1 /* without trailer */
+	frameChecksum = 1
+	frameSize     = 2
+	frameDict     = 4
+	frameTyped    = 8
+	frameFlags    = frameChecksum | frameSize | frameDict | frameTyped
+	/* segment is flushed automatically when it reaches frameSegment bytes */
+	frameSegment = 1 << 18
+)
+
+// SegmentType is a type of frame segment, see format above
+type SegmentType uint8
+
+const (
+	SegmentTokens  SegmentType = 0 // tokens ended with flush mark
+	SegmentHuffman SegmentType = 1 // Huffman coded tokens
+	SegmentStored  SegmentType = 2 // uncompressed bytes
+	// SegmentTrailer is returned by FrameReader.NextSegment for trailer,
+	// it is not a type byte of segment
+	SegmentTrailer SegmentType = 0xff
+)
+
+var (
+	// ErrHeader is returned when frame header is invalid
+	ErrHeader = errors.New("funlz: invalid frame header")
+	// ErrChecksum is returned when segment checksum or declared size doesn't match
+	ErrChecksum = errors.New("funlz: invalid checksum")
+	// ErrDictionary is returned when frame needs dictionary other than given to FrameReader
+	ErrDictionary = errors.New("funlz: dictionary mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// FrameOptions tunes FrameWriter
+type FrameOptions struct {
+	// Options tunes compression of segments
+	Options
+	// Checksum enables crc32c checksum of every segment
+	Checksum bool
+	// HasContentSize declares uncompressed size ContentSize in header,
+	// FrameWriter checks it on Write and Close. Size is unknown otherwise.
+	HasContentSize bool
+	ContentSize    int64
+	// Huffman codes tags and literals of segments with Huffman codes,
+	// if it makes segment smaller. It is slower, but compresses text better.
+	Huffman bool
+	// Store writes segment uncompressed if compression doesn't make it smaller,
+	// so incompressible data grows only by segment headers.
+	Store bool
+}
+
+/*
+FrameWriter is a streaming compressor which writes frame format.
+Each Flush ends segment, which is checksumed and written to underlying writer.
+Close should be called to flush last segment, check declared content size
+and write trailer, which tells FrameReader that frame is complete.
+
+	comp := funlz.NewFrameWriter(my_file)
+	comp.Write(data)
+	comp.Close()
+*/
+type FrameWriter struct {
+	w      io.Writer
+	z      *Writer
+	seg    bytes.Buffer /* compressed tokens of current segment */
+	huff   []byte       /* Huffman coded segment */
+	raw    []byte       /* uncompressed bytes of segment, if Store */
+	opts   FrameOptions
+	err    error
+	header bool /* header is written */
+	crc    uint32
+	n      int64 /* uncompressed bytes in current segment */
+	total  int64
+}
+
+// NewFrameWriter wraps io.Writer into FrameWriter with checksums, stored
+// incompressible segments and unknown content size
+func NewFrameWriter(wr io.Writer) *FrameWriter {
+	f, _ := NewFrameWriterOptions(wr, FrameOptions{Checksum: true, Store: true})
+	return f
+}
+
+// NewFrameWriterOptions wraps io.Writer into FrameWriter tuned with FrameOptions
+func NewFrameWriterOptions(wr io.Writer, o FrameOptions) (f *FrameWriter, err error) {
+	f = &FrameWriter{w: wr, opts: o}
+	if f.z, err = NewWriterOptions(&f.seg, o.Options); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reset discards FrameWriter state and makes it write new frame to wr with same FrameOptions
+func (f *FrameWriter) Reset(wr io.Writer) {
+	f.w = wr
+	f.z.Reset(&f.seg)
+	f.seg.Reset()
+	f.raw = f.raw[:0]
+	f.err = nil
+	f.header = false
+	f.crc = 0
+	f.n = 0
+	f.total = 0
+}
+
+func (f *FrameWriter) writeHeader() (err error) {
+	var hdr [len(frameMagic) + 2 + binary.MaxVarintLen64 + 4]byte
+	n := copy(hdr[:], frameMagic)
+	hdr[n] = frameVersion
+	if f.opts.Checksum {
+		hdr[n+1] |= frameChecksum
+	}
+	n += 2
+	if f.opts.HasContentSize {
+		hdr[len(frameMagic)+1] |= frameSize
+		n += binary.PutUvarint(hdr[n:], uint64(f.opts.ContentSize))
+	}
+	if f.opts.Dict != nil {
+		hdr[len(frameMagic)+1] |= frameDict
+		binary.LittleEndian.PutUint32(hdr[n:], f.opts.Dict.ID())
+		n += 4
+	}
+	if f.opts.Huffman || f.opts.Store {
+		hdr[len(frameMagic)+1] |= frameTyped
+	}
+	_, err = f.w.Write(hdr[:n])
+	f.header = true
+	return
+}
+
+// Write provides io.Writer
+func (f *FrameWriter) Write(b []byte) (n int, err error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.opts.HasContentSize && f.total+int64(len(b)) > f.opts.ContentSize {
+		f.err = &TooLargeError{Offset: f.total, Limit: f.opts.ContentSize}
+		return 0, f.err
+	}
+	for len(b) != 0 {
+		l := frameSegment - f.n
+		if l > int64(len(b)) {
+			l = int64(len(b))
+		}
+		/* Writer writes into bytes.Buffer, so it doesn't fail */
+		f.z.Write(b[:l])
+		if f.opts.Store {
+			f.raw = append(f.raw, b[:l]...)
+		}
+		f.crc = crc32.Update(f.crc, castagnoli, b[:l])
+		f.n += l
+		f.total += l
+		n += int(l)
+		b = b[l:]
+		if f.n == frameSegment {
+			if err = f.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Flush writes segment with all data written so far. Returns error encounted during writting.
+func (f *FrameWriter) Flush() (err error) {
+	if f.err != nil {
+		return f.err
+	}
+	if !f.header {
+		if f.err = f.writeHeader(); f.err != nil {
+			return f.err
+		}
+	}
+	if f.n == 0 {
+		return nil
+	}
+	f.z.Flush()
+	payload, typ := f.seg.Bytes(), SegmentTokens
+	if f.opts.Huffman {
+		if f.huff = huffEncode(f.huff[:0], payload); len(f.huff) < len(payload) {
+			payload, typ = f.huff, SegmentHuffman
+		}
+	}
+	if f.opts.Store && int64(len(payload)) >= f.n {
+		payload, typ = f.raw, SegmentStored
+	}
+	var hdr [2*binary.MaxVarintLen64 + 5]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(payload)))
+	n += binary.PutUvarint(hdr[n:], uint64(f.n))
+	if f.opts.Huffman || f.opts.Store {
+		hdr[n] = byte(typ)
+		n++
+	}
+	if f.opts.Checksum {
+		binary.LittleEndian.PutUint32(hdr[n:], f.crc)
+		n += 4
+	}
+	if _, f.err = f.w.Write(hdr[:n]); f.err == nil {
+		_, f.err = f.w.Write(payload)
+	}
+	f.seg.Reset()
+	f.raw = f.raw[:0]
+	f.crc = 0
+	f.n = 0
+	return f.err
+}
+
+// Close flushes last segment, checks declared content size and writes trailer.
+// It closes wrapped writer only if Options.CloseWriter is set.
+// Following calls of FrameWriter return ErrClosed until Reset.
+func (f *FrameWriter) Close() (err error) {
+	if f.err == ErrClosed {
+		return nil
+	}
+	if err = f.Flush(); err != nil {
+		return
+	}
+	if f.opts.HasContentSize && f.total != f.opts.ContentSize {
+		f.err = fmt.Errorf("funlz: written %d bytes, but declared content size %d", f.total, f.opts.ContentSize)
+		return f.err
+	}
+	var trailer [1 + binary.MaxVarintLen64]byte
+	n := 1 + binary.PutUvarint(trailer[1:], uint64(f.total))
+	if _, f.err = f.w.Write(trailer[:n]); f.err != nil {
+		return f.err
+	}
+	if c, ok := f.w.(io.Closer); ok && f.opts.CloseWriter {
+		if f.err = c.Close(); f.err != nil {
+			return f.err
+		}
+	}
+	f.err = ErrClosed
+	return nil
+}
+
+/*
+FrameReader is a streaming decompressor of frame format.
+Every segment is decoded and checked before its bytes are returned,
+so corrupted data is never passed to caller. Read returns io.EOF only after
+trailer, so frame cut at segment boundary gives *TruncatedError. Input which
+provides ReadByte is not read after trailer, so next frame could follow.
+*/
+type FrameReader struct {
+	r     readAndByteReader
+	br    *bufio.Reader
+	dict  *Dictionary
+	vers  byte
+	flags byte
+	size  int64  /* declared content size or -1 */
+	total int64  /* uncompressed bytes read */
+	cpos  int64  /* compressed bytes read */
+	seg   []byte /* compressed segment */
+	out   []byte /* uncompressed segment */
+	pos   int    /* read position in out */
+	err   error
+}
+
+// NewFrameReader wraps io.Reader into FrameReader and reads frame header.
+// If input provides ReadByte, then it is not wrapped by bufio.Reader
+func NewFrameReader(rd io.Reader) (f *FrameReader, err error) {
+	f = &FrameReader{}
+	if err = f.Reset(rd); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewFrameReaderDict wraps io.Reader into FrameReader which could read frames
+// compressed with dictionary d
+func NewFrameReaderDict(rd io.Reader, d *Dictionary) (f *FrameReader, err error) {
+	f = &FrameReader{dict: d}
+	if err = f.Reset(rd); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reset discards FrameReader state and reads new frame header from rd.
+// Segment buffers and bufio.Reader are reused.
+func (f *FrameReader) Reset(rd io.Reader) (err error) {
+	if rb, ok := rd.(readAndByteReader); ok {
+		f.r = rb
+	} else {
+		if f.br == nil {
+			f.br = bufio.NewReader(rd)
+		} else {
+			f.br.Reset(rd)
+		}
+		f.r = f.br
+	}
+	f.flags = 0
+	f.size = -1
+	f.total = 0
+	f.cpos = int64(len(frameMagic) + 2)
+	f.out = f.out[:0]
+	f.pos = 0
+	f.err = nil
+	var hdr [len(frameMagic) + 2]byte
+	if _, err = io.ReadFull(f.r, hdr[:]); err != nil {
+		f.err = truncated(err, 0)
+		return f.err
+	}
+	f.vers = hdr[len(frameMagic)]
+	if string(hdr[:len(frameMagic)]) != frameMagic || f.vers != frameVersion && f.vers != frameVersion1 {
+		f.err = ErrHeader
+		return f.err
+	}
+	f.flags = hdr[len(frameMagic)+1]
+	if f.flags&^frameFlags != 0 {
+		f.err = ErrHeader
+		return f.err
+	}
+	if f.flags&frameSize != 0 {
+		var size uint64
+		if size, err = binary.ReadUvarint(f.r); err != nil {
+			f.err = truncated(err, 0)
+			return f.err
+		}
+		if size > 1<<62 {
+			f.err = ErrHeader
+			return f.err
+		}
+		f.size = int64(size)
+		f.cpos += uvarintLen(size)
+	}
+	if f.flags&frameDict != 0 {
+		var id [4]byte
+		if _, err = io.ReadFull(f.r, id[:]); err != nil {
+			f.err = truncated(err, 0)
+			return f.err
+		}
+		f.cpos += 4
+		if f.dict == nil || f.dict.ID() != binary.LittleEndian.Uint32(id[:]) {
+			f.err = ErrDictionary
+			return f.err
+		}
+	}
+	return nil
+}
+
+// ContentSize returns declared uncompressed size, or -1 if it is unknown
+func (f *FrameReader) ContentSize() int64 {
+	return f.size
+}
+
+// Read provides io.Reader
+func (f *FrameReader) Read(b []byte) (n int, err error) {
+	for f.pos == len(f.out) {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.err = f.readSegment()
+	}
+	n = copy(b, f.out[f.pos:])
+	f.pos += n
+	return
+}
+
+func (f *FrameReader) readSegment() (err error) {
+	f.out = f.out[:0]
+	f.pos = 0
+	s, err := f.segment()
+	if err != nil {
+		return
+	}
+	if s.Type == SegmentTrailer {
+		return f.checkTrailer(s.Uncompressed)
+	}
+	var hist []byte
+	if f.flags&frameDict != 0 {
+		hist = f.dict.data
+	}
+	ulen := int(s.Uncompressed)
+	out := f.out[:0]
+	if cap(out) < len(hist)+ulen {
+		out = make([]byte, 0, len(hist)+ulen)
+	}
+	switch s.Type {
+	case SegmentHuffman:
+		out, err = huffDecode(append(out, hist...), s.Payload, 0, ulen)
+	case SegmentStored:
+		if len(s.Payload) != ulen {
+			return &CorruptError{Offset: s.Offset}
+		}
+		out = append(append(out, hist...), s.Payload...)
+	default:
+		out, err = decode(append(out, hist...), s.Payload, 0, true)
+	}
+	if err != nil {
+		if ce, ok := err.(*CorruptError); ok {
+			ce.Offset += s.PayloadOffset
+		}
+		return
+	}
+	if len(out)-len(hist) != ulen {
+		return ErrChecksum
+	}
+	if s.HasChecksum && crc32.Checksum(out[len(hist):], castagnoli) != s.Checksum {
+		return ErrChecksum
+	}
+	if err = f.count(s.Uncompressed); err != nil {
+		return
+	}
+	f.out = out
+	f.pos = len(hist)
+	return nil
+}
+
+// Segment is a segment of frame as it is stored, returned by FrameReader.NextSegment
+type Segment struct {
+	Type          SegmentType
+	Offset        int64  // compressed offset of segment header
+	PayloadOffset int64  // compressed offset of Payload
+	Uncompressed  int64  // uncompressed len of segment, or of whole frame for trailer
+	HasChecksum   bool   // frame has checksums
+	Checksum      uint32 // crc32c of uncompressed bytes
+	// Payload is compressed bytes of segment, valid until next call to FrameReader
+	Payload []byte
+	dict    *Dictionary
+}
+
+// Tokens returns TokenReader of SegmentTokens payload, with dictionary of frame
+func (s *Segment) Tokens() *TokenReader {
+	return NewTokenReaderDict(bytes.NewReader(s.Payload), s.dict)
+}
+
+/*
+NextSegment reads next segment of frame without decoding it, for tools
+which inspect frames. Segment lengths, frame length in trailer and
+content size are checked, but payload and checksum are not.
+Trailer is returned as segment of SegmentTrailer type, and io.EOF follows it.
+NextSegment and Read should not be mixed.
+*/
+func (f *FrameReader) NextSegment() (s Segment, err error) {
+	if f.err != nil {
+		return s, f.err
+	}
+	f.out = f.out[:0]
+	f.pos = 0
+	if s, err = f.segment(); err == nil {
+		if s.Type == SegmentTrailer {
+			if err = f.checkTrailer(s.Uncompressed); err == io.EOF {
+				f.err = io.EOF
+				return s, nil
+			}
+		} else {
+			err = f.count(s.Uncompressed)
+		}
+	}
+	f.err = err
+	return
+}
+
+/* segment reads header and payload of segment into f.seg, or trailer */
+func (f *FrameReader) segment() (s Segment, err error) {
+	s.Offset = f.cpos
+	clen, err := binary.ReadUvarint(f.r)
+	if err != nil {
+		if err == io.EOF && (f.vers != frameVersion1 || f.size >= 0 && f.total != f.size) {
+			err = &TruncatedError{Offset: s.Offset}
+		}
+		return
+	}
+	if clen == 0 && f.vers != frameVersion1 {
+		/* trailer, input is not read after it */
+		f.cpos++
+		var total uint64
+		if total, err = binary.ReadUvarint(f.r); err != nil {
+			return s, truncated(err, s.Offset)
+		}
+		f.cpos += uvarintLen(total)
+		s.Type = SegmentTrailer
+		s.Uncompressed = int64(total)
+		return
+	}
+	ulen, err := binary.ReadUvarint(f.r)
+	if err == nil && (ulen == 0 || ulen > frameSegment || clen > uint64(MaxCompressedLen(int(ulen)))) {
+		err = &CorruptError{Offset: s.Offset}
+	}
+	if err == nil && f.flags&frameTyped != 0 {
+		var typ byte
+		if typ, err = f.r.ReadByte(); err == nil && typ > byte(SegmentStored) {
+			err = &CorruptError{Offset: s.Offset}
+		}
+		s.Type = SegmentType(typ)
+		f.cpos++
+	}
+	if err == nil && f.flags&frameChecksum != 0 {
+		var crc [4]byte
+		_, err = io.ReadFull(f.r, crc[:])
+		s.HasChecksum = true
+		s.Checksum = binary.LittleEndian.Uint32(crc[:])
+	}
+	f.cpos += uvarintLen(clen) + uvarintLen(ulen)
+	if f.flags&frameChecksum != 0 {
+		f.cpos += 4
+	}
+	if err == nil {
+		if cap(f.seg) < int(clen) {
+			f.seg = make([]byte, clen)
+		}
+		f.seg = f.seg[:clen]
+		_, err = io.ReadFull(f.r, f.seg)
+	}
+	if err != nil {
+		return s, truncated(err, s.Offset)
+	}
+	s.PayloadOffset = f.cpos
+	f.cpos += int64(clen)
+	s.Uncompressed = int64(ulen)
+	s.Payload = f.seg
+	if f.flags&frameDict != 0 {
+		s.dict = f.dict
+	}
+	return
+}
+
+/* count adds segment of n bytes to frame length */
+func (f *FrameReader) count(n int64) error {
+	f.total += n
+	if f.size >= 0 && f.total > f.size {
+		return ErrChecksum
+	}
+	return nil
+}
+
+/* checkTrailer checks frame length total written in trailer */
+func (f *FrameReader) checkTrailer(total int64) error {
+	if total != f.total || f.size >= 0 && f.total != f.size {
+		return ErrChecksum
+	}
+	return io.EOF
+}
+
+// Close returns error encountered during reading, if it is not io.EOF.
+// Following reads return ErrClosed until Reset.
+func (f *FrameReader) Close() (err error) {
+	if f.err != io.EOF && f.err != ErrClosed {
+		err = f.err
+	}
+	f.err = ErrClosed
+	f.pos = len(f.out)
+	return
+}
+
+func uvarintLen(x uint64) int64 {
+	n := int64(1)
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,331 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func frameCompress(in []byte, o FrameOptions) []byte {
+	var out bytes.Buffer
+	f, err := NewFrameWriterOptions(&out, o)
+	if err != nil {
+		panic(err)
+	}
+	rnd := uint32(0)
+	for len(in) != 0 {
+		rnd = rnd*5 + 1
+		l := int(rnd%40000) + 1
+		if l > len(in) {
+			l = len(in)
+		}
+		f.Write(in[:l])
+		if rnd%3 == 0 {
+			f.Flush()
+		}
+		in = in[l:]
+	}
+	if err = f.Close(); err != nil {
+		panic(err)
+	}
+	return out.Bytes()
+}
+
+func frameDecompress(in []byte) ([]byte, error) {
+	f, err := NewFrameReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+func TestFrame(t *testing.T) {
+	opts := []FrameOptions{
+		{},
+		{Checksum: true},
+		{Checksum: true, HasContentSize: true, ContentSize: int64(len(original))},
+		{Options: Options{HashLog: 12, BackRef: 4}, HasContentSize: true, ContentSize: int64(len(original))},
+	}
+	for _, o := range opts {
+		c := frameCompress(original, o)
+		d, err := frameDecompress(c)
+		if err != nil {
+			t.Errorf("%+v: %v", o, err)
+		}
+		if p := eq(original, d); p != -1 {
+			t.Errorf("%+v: not equal at %d", o, p)
+		}
+	}
+}
+
+func TestFrameEmpty(t *testing.T) {
+	var out bytes.Buffer
+	f := NewFrameWriter(&out)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := frameDecompress(out.Bytes())
+	if err != nil || len(d) != 0 {
+		t.Errorf("empty frame: %v %q", err, d)
+	}
+}
+
+func TestFrameContentSize(t *testing.T) {
+	var out bytes.Buffer
+	f, _ := NewFrameWriterOptions(&out, FrameOptions{HasContentSize: true, ContentSize: 10})
+	if _, err := f.Write(make([]byte, 11)); err == nil {
+		t.Errorf("write over content size: no error")
+	}
+	f, _ = NewFrameWriterOptions(&out, FrameOptions{HasContentSize: true, ContentSize: 10})
+	f.Write(make([]byte, 9))
+	if err := f.Close(); err == nil {
+		t.Errorf("close under content size: no error")
+	}
+	c := frameCompress(original[:11111], FrameOptions{HasContentSize: true, ContentSize: 11111})
+	r, _ := NewFrameReader(bytes.NewReader(c))
+	if r.ContentSize() != 11111 {
+		t.Errorf("content size %d", r.ContentSize())
+	}
+	c = frameCompress(original[:100], FrameOptions{})
+	if r, _ = NewFrameReader(bytes.NewReader(c)); r.ContentSize() != -1 {
+		t.Errorf("zero options: content size %d", r.ContentSize())
+	}
+	c = frameCompress(nil, FrameOptions{HasContentSize: true})
+	if r, _ = NewFrameReader(bytes.NewReader(c)); r.ContentSize() != 0 {
+		t.Errorf("empty: content size %d", r.ContentSize())
+	}
+}
+
+func TestFrameCorrupt(t *testing.T) {
+	c := frameCompress(original, FrameOptions{Checksum: true, HasContentSize: true, ContentSize: int64(len(original))})
+	if _, err := frameDecompress(c[:len(c)-100]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated: %v", err)
+	}
+	if _, err := frameDecompress([]byte("FnLz\x01\x00")); err != ErrHeader {
+		t.Errorf("bad magic: %v", err)
+	}
+	for _, p := range []int{100, 1000, len(c) / 2, len(c) - 10} {
+		b := append([]byte(nil), c...)
+		b[p] ^= 0x10
+		if _, err := frameDecompress(b); err == nil {
+			t.Errorf("flipped bit at %d: no error", p)
+		}
+	}
+}
+
+func TestFrameReset(t *testing.T) {
+	var out bytes.Buffer
+	f := NewFrameWriter(ioutil.Discard)
+	f.Write(original[:1000])
+	f.Reset(&out)
+	f.Write(original[:11111])
+	f.Close()
+	r, err := NewFrameReader(bytes.NewReader(frameCompress(original, FrameOptions{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 100))
+	if err = r.Reset(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil || eq(original[:11111], d) != -1 {
+		t.Errorf("FrameReader after Reset: %v", err)
+	}
+}
+
+func TestFrameCorruptOffset(t *testing.T) {
+	c := []byte("FnLZ\x01\x00\x04\x05\x01a\x20\x05\x00")
+	_, err := frameDecompress(c)
+	if ce, ok := err.(*CorruptError); !ok || ce.Offset != 10 {
+		t.Errorf("expected corrupt at 10, got %v", err)
+	}
+	/* segment ends inside of token */
+	_, err = frameDecompress([]byte("FnLZ\x01\x00\x03\x05\x05ab"))
+	if ce, ok := err.(*CorruptError); !ok || ce.Offset != 8 {
+		t.Errorf("expected corrupt at 8, got %v", err)
+	}
+	/* segment should end with flush mark, and have no other */
+	for c, off := range map[string]int64{"FnLZ\x01\x00\x03\x02\x02ab": 11, "FnLZ\x01\x00\x05\x02\x00\x02ab\x00": 8} {
+		_, err = frameDecompress([]byte(c))
+		if ce, ok := err.(*CorruptError); !ok || ce.Offset != off {
+			t.Errorf("%q: expected corrupt at %d, got %v", c, off, err)
+		}
+	}
+}
+
+func TestFrameNextSegment(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	b := make([]byte, frameSegment)
+	rnd.Read(b)
+	b = append(b, original[:100000]...)
+	for _, o := range []FrameOptions{
+		{Checksum: true, Store: true, HasContentSize: true, ContentSize: int64(len(b))},
+		{Huffman: true, Store: true},
+	} {
+		c := frameCompress(b, o)
+		f, err := NewFrameReader(bytes.NewReader(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d []byte
+		types := map[SegmentType]int{}
+		next := int64(6 + uvarintLen(uint64(len(b))))
+		if !o.HasContentSize {
+			next = 6
+		}
+		for {
+			s, err := f.NextSegment()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%+v: %v", o, err)
+			}
+			types[s.Type]++
+			if s.Offset != next {
+				t.Errorf("%+v: segment at %d, expected %d", o, s.Offset, next)
+			}
+			if s.Type == SegmentTrailer {
+				if s.Uncompressed != int64(len(b)) || s.Offset != int64(len(c))-1-uvarintLen(uint64(len(b))) {
+					t.Errorf("%+v: trailer at %d: %d bytes", o, s.Offset, s.Uncompressed)
+				}
+				continue
+			}
+			if s.HasChecksum != o.Checksum {
+				t.Errorf("%+v: checksum %v", o, s.HasChecksum)
+			}
+			next = s.PayloadOffset + int64(len(s.Payload))
+			switch s.Type {
+			case SegmentStored:
+				d = append(d, s.Payload...)
+			case SegmentTokens:
+				tr := s.Tokens()
+				for tok, err := tr.Next(); err != io.EOF; tok, err = tr.Next() {
+					if err != nil {
+						t.Fatalf("%+v: tokens: %v", o, err)
+					}
+					d = append(d, tok.Data...)
+				}
+			}
+		}
+		if o.Huffman {
+			if types[SegmentHuffman] == 0 || types[SegmentStored] == 0 {
+				t.Errorf("%+v: segment types %v", o, types)
+			}
+		} else if eq(b, d) != -1 {
+			t.Errorf("%+v: segments are not equal to input", o)
+		}
+		if _, err = f.NextSegment(); err != io.EOF {
+			t.Errorf("%+v: after trailer: %v", o, err)
+		}
+	}
+}
+
+func TestFrameStore(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	b := make([]byte, 3*frameSegment/2)
+	rnd.Read(b)
+	var out bytes.Buffer
+	f := NewFrameWriter(&out)
+	f.Write(b)
+	f.Close()
+	/* header, two segment headers and trailer */
+	if max := len(b) + 6 + 2*(3+3+1+4) + 1 + 3; out.Len() > max {
+		t.Errorf("compressed %d bytes, expected at most %d", out.Len(), max)
+	}
+	/* text after random bytes is still compressed */
+	b = append(b, original[:100000]...)
+	c := frameCompress(b, FrameOptions{Checksum: true, Store: true})
+	if max := len(b) - 100000/3; len(c) > max {
+		t.Errorf("compressed %d bytes, expected at most %d", len(c), max)
+	}
+	d, err := frameDecompress(c)
+	if err != nil || eq(b, d) != -1 {
+		t.Errorf("round trip failed: %v", err)
+	}
+	/* stored segment should have equal lengths */
+	if d, err = frameDecompress([]byte("FnLZ\x01\x08\x02\x02\x02ab")); err != nil || string(d) != "ab" {
+		t.Errorf("stored segment: %q %v", d, err)
+	}
+	if _, err = frameDecompress([]byte("FnLZ\x01\x08\x03\x02\x02abc")); err == nil {
+		t.Errorf("stored segment with wrong length: no error")
+	}
+}
+
+func BenchmarkFrameCompressRandom(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	in := make([]byte, 1<<20)
+	rnd.Read(in)
+	f := NewFrameWriter(ioutil.Discard)
+	b.SetBytes(int64(len(in)))
+	for i := 0; i < b.N; i++ {
+		f.Reset(ioutil.Discard)
+		f.Write(in)
+		f.Close()
+	}
+}
+
+func TestFrameTrailer(t *testing.T) {
+	c := frameCompress(original[:11111], FrameOptions{Checksum: true})
+	/* trailer is [0] [uvarint 11111] */
+	if _, err := frameDecompress(c[:len(c)-3]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("frame without trailer: %v", err)
+	}
+	if _, err := frameDecompress(c[:len(c)-1]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated trailer: %v", err)
+	}
+	b := append([]byte(nil), c...)
+	b[len(b)-1]++
+	if _, err := frameDecompress(b); err != ErrChecksum {
+		t.Errorf("wrong length in trailer: %v", err)
+	}
+	/* frames follow each other, input is not read after trailer */
+	in := bytes.NewReader(append(append([]byte(nil), c...), frameCompress(original[:100], FrameOptions{})...))
+	for _, l := range []int{11111, 100} {
+		f, err := NewFrameReader(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(f)
+		if err != nil || eq(original[:l], d) != -1 {
+			t.Errorf("frame of %d bytes: %v", l, err)
+		}
+	}
+	/* version 1 frame ends at end of input */
+	if d, err := frameDecompress([]byte("FnLZ\x01\x00\x04\x02\x02ab\x00")); err != nil || string(d) != "ab" {
+		t.Errorf("version 1 frame: %q %v", d, err)
+	}
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeBuffer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestCloseWriter(t *testing.T) {
+	for _, close := range []bool{false, true} {
+		var out closeBuffer
+		w, _ := NewWriterOptions(&out, Options{CloseWriter: close})
+		w.Write([]byte("hello"))
+		if err := w.Close(); err != nil || out.closed != close {
+			t.Errorf("Writer with CloseWriter %v: closed %v, %v", close, out.closed, err)
+		}
+		out = closeBuffer{}
+		f, _ := NewFrameWriterOptions(&out, FrameOptions{Options: Options{CloseWriter: close}})
+		f.Write([]byte("hello"))
+		if err := f.Close(); err != nil || out.closed != close {
+			t.Errorf("FrameWriter with CloseWriter %v: closed %v, %v", close, out.closed, err)
+		}
+		if d, err := frameDecompress(out.Bytes()); err != nil || string(d) != "hello" {
+			t.Errorf("%q %v", d, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package funlz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+/*
+script drives Writer: every byte is an operation, low 2 bits choose it
+and rest bits give length of Write.
+*/
+func fuzzCompress(data, script []byte) []byte {
+	var out bytes.Buffer
+	c := NewWriter(&out)
+	for _, op := range script {
+		if len(data) == 0 {
+			break
+		}
+		switch op & 3 {
+		case 0:
+			l := int(op>>2) * 97
+			if l > len(data) {
+				l = len(data)
+			}
+			c.Write(data[:l])
+			data = data[l:]
+		case 1:
+			c.WriteByte(data[0])
+			data = data[1:]
+		case 2:
+			c.FlushSync()
+		case 3:
+			c.FlushFull()
+		}
+	}
+	c.Write(data)
+	c.Flush()
+	return out.Bytes()
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, p := range patterns {
+		f.Add(p[0], []byte{0x10, 1, 2, 0xff, 3})
+	}
+	f.Fuzz(func(t *testing.T, data, script []byte) {
+		c := fuzzCompress(data, script)
+		if len(c) > MaxCompressedLen(len(data))+3*len(script) {
+			t.Errorf("compressed %d more than bound", len(c))
+		}
+		o, err := ioutil.ReadAll(NewReader(bytes.NewReader(c)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := eq(data, o); p != -1 {
+			t.Fatalf("Reader differs at %d", p)
+		}
+		o = o[:0]
+		r := NewReader(bytes.NewReader(c))
+		for {
+			b, err := r.ReadByte()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			o = append(o, b)
+		}
+		if p := eq(data, o); p != -1 {
+			t.Fatalf("ReadByte differs at %d", p)
+		}
+		if o, err = Decompress(nil, c); err != nil || eq(data, o) != -1 {
+			t.Fatalf("Decompress differs: %v", err)
+		}
+		if o, err = Decompress(nil, Compress(nil, data)); err != nil || eq(data, o) != -1 {
+			t.Fatalf("block round trip differs: %v", err)
+		}
+	})
+}
+
+/* output of any token is at most maxCopy per 3 input bytes */
+const fuzzMaxRatio = maxCopy/3 + 1
+
+/* sameError reports if errors have same type, text and offset */
+func sameError(a, b error) bool {
+	offset := func(err error) int64 {
+		switch e := err.(type) {
+		case *CorruptError:
+			return e.Offset
+		case *TruncatedError:
+			return e.Offset
+		case *TooLargeError:
+			return e.Offset
+		}
+		return -1
+	}
+	return fmt.Sprintf("%T %v", a, a) == fmt.Sprintf("%T %v", b, b) && offset(a) == offset(b)
+}
+
+func FuzzReader(f *testing.F) {
+	for _, p := range patterns {
+		f.Add(p[1])
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		o1, err1 := ioutil.ReadAll(NewReader(bytes.NewReader(in)))
+		o2, err2 := ioutil.ReadAll(NewReader(bytes.NewReader(in)))
+		if eq(o1, o2) != -1 || !sameError(err1, err2) {
+			t.Fatalf("not deterministic: %v %v", err1, err2)
+		}
+		if len(o1) > len(in)*fuzzMaxRatio {
+			t.Fatalf("%d bytes from %d", len(o1), len(in))
+		}
+		d, err := Decompress(nil, in)
+		if eq(o1, d) != -1 {
+			t.Fatalf("Reader and Decompress differs: %v %v", err1, err)
+		}
+		if ce, ok := err.(*CorruptError); ok {
+			if ce1, ok := err1.(*CorruptError); !ok || ce1.Offset != ce.Offset {
+				t.Fatalf("Reader and Decompress errors differs: %v %v", err1, err)
+			}
+		}
+	})
+}
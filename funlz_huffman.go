@@ -0,0 +1,368 @@
+package funlz
+
+import (
+	"sort"
+)
+
+/*
+Huffman coded segment keeps token stream of doc.go, but token tags and
+literal bytes are Huffman coded with codes built for the segment:
+
+	<128 bytes: code lengths of tags, 4 bits each, low nibble first>
+	<128 bytes: code lengths of literal bytes>
+	<bits, least significant first>
+		tag code
+		+ <8 bits len-31 if tag is big literal> + <literal byte codes>
+		or
+		+ <8 bits off&0xff> + <8 bits len-17 if tag is big copy>
+
+Code length 0 means symbol is not used. Segment has no flush mark: it ends
+when uncompressed length from segment header is decoded.
+*/
+const (
+	huffMaxBits   = 12
+	huffTableSize = 256 / 2
+)
+
+/* huffCode keeps lengths and codes (bit reversed) of 256 symbols */
+type huffCode struct {
+	len  [256]uint8
+	code [256]uint16
+}
+
+/* build makes length limited code for frequencies */
+func (h *huffCode) build(freq *[256]int32) {
+	f := *freq
+	for !h.lengths(&f) {
+		/* flatten frequencies until code fits huffMaxBits */
+		for i := range f {
+			if f[i] != 0 {
+				f[i] = f[i]>>1 | 1
+			}
+		}
+	}
+	h.assign()
+}
+
+/* lengths computes Huffman code lengths and reports if they fit huffMaxBits */
+func (h *huffCode) lengths(freq *[256]int32) bool {
+	h.len = [256]uint8{}
+	var syms []int
+	for s, f := range freq {
+		if f != 0 {
+			syms = append(syms, s)
+		}
+	}
+	switch len(syms) {
+	case 0:
+		return true
+	case 1:
+		h.len[syms[0]] = 1
+		return true
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return freq[syms[i]] < freq[syms[j]] })
+	/* two queues: sorted leaves and internal nodes created in increasing order */
+	n := len(syms)
+	weight := make([]int32, 0, 2*n)
+	for _, s := range syms {
+		weight = append(weight, freq[s])
+	}
+	parent := make([]int, 2*n-1)
+	leaf, inner := 0, n
+	pick := func() int {
+		if leaf < n && (inner >= len(weight) || weight[leaf] <= weight[inner]) {
+			leaf++
+			return leaf - 1
+		}
+		inner++
+		return inner - 1
+	}
+	for len(weight) < 2*n-1 {
+		a, b := pick(), pick()
+		parent[a], parent[b] = len(weight), len(weight)
+		weight = append(weight, weight[a]+weight[b])
+	}
+	depth := make([]int, 2*n-1)
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+		if i < n {
+			if depth[i] > huffMaxBits {
+				return false
+			}
+			h.len[syms[i]] = uint8(depth[i])
+		}
+	}
+	return true
+}
+
+/* assign gives canonical codes for lengths */
+func (h *huffCode) assign() {
+	var count, next [huffMaxBits + 1]uint16
+	for _, l := range h.len {
+		count[l]++
+	}
+	count[0] = 0
+	code := uint16(0)
+	for l := 1; l <= huffMaxBits; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range h.len {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		/* bits are written least significant first, so code is reversed */
+		r := uint16(0)
+		for i := uint8(0); i < l; i++ {
+			r = r<<1 | c&1
+			c >>= 1
+		}
+		h.code[s] = r
+	}
+}
+
+/* huffTable maps next huffMaxBits bits to symbol<<4 | length */
+type huffTable [1 << huffMaxBits]uint16
+
+/* build fills table from lengths, reports false for over-subscribed code */
+func (t *huffTable) build(h *huffCode) bool {
+	sum := 0
+	for _, l := range h.len {
+		if l != 0 {
+			sum += 1 << (huffMaxBits - l)
+		}
+	}
+	if sum > 1<<huffMaxBits {
+		return false
+	}
+	*t = huffTable{}
+	h.assign()
+	for s, l := range h.len {
+		if l == 0 {
+			continue
+		}
+		for k := int(h.code[s]); k < len(t); k += 1 << l {
+			t[k] = uint16(s)<<4 | uint16(l)
+		}
+	}
+	return true
+}
+
+type bitWriter struct {
+	b   []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) write(v uint16, l uint8) {
+	w.acc |= uint64(v) << w.n
+	w.n += uint(l)
+	for w.n >= 8 {
+		w.b = append(w.b, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.n > 0 {
+		w.b = append(w.b, byte(w.acc))
+	}
+	return w.b
+}
+
+type bitReader struct {
+	b   []byte
+	acc uint64
+	n   uint
+	pad uint /* zero bits added after end of b */
+}
+
+func (r *bitReader) fill() {
+	for r.n <= 56 {
+		if len(r.b) != 0 {
+			r.acc |= uint64(r.b[0]) << r.n
+			r.b = r.b[1:]
+		} else {
+			r.pad += 8
+		}
+		r.n += 8
+	}
+}
+
+/* decode returns next symbol or -1 if bits are not a code */
+func (r *bitReader) decode(t *huffTable) int {
+	if r.n < huffMaxBits {
+		r.fill()
+	}
+	e := t[r.acc&(1<<huffMaxBits-1)]
+	l := uint(e & 15)
+	if l == 0 {
+		return -1
+	}
+	r.acc >>= l
+	r.n -= l
+	return int(e >> 4)
+}
+
+func (r *bitReader) byte() byte {
+	if r.n < 8 {
+		r.fill()
+	}
+	b := byte(r.acc)
+	r.acc >>= 8
+	r.n -= 8
+	return b
+}
+
+/* overrun reports if padding bits were consumed */
+func (r *bitReader) overrun() bool {
+	return r.pad > r.n
+}
+
+/*
+huffEncode appends Huffman coded tokens to dst. tokens is a stream of doc.go
+format without flush marks inside, final flush mark is dropped.
+*/
+func huffEncode(dst, tokens []byte) []byte {
+	var tags, lits [256]int32
+	for i := 0; i < len(tokens); {
+		tag := tokens[i]
+		switch {
+		case tag == 0:
+			i++
+			continue
+		case tag < 0x20:
+			tags[tag]++
+			l := int(tag)
+			i++
+			if tag == smallLit+1 {
+				l += int(tokens[i])
+				i++
+			}
+			for _, c := range tokens[i : i+l] {
+				lits[c]++
+			}
+			i += l
+		default:
+			tags[tag]++
+			i += 2
+			if tag>>4 == smallCopy-1 {
+				i++
+			}
+		}
+	}
+	var th, lh huffCode
+	th.build(&tags)
+	lh.build(&lits)
+	for _, h := range []*huffCode{&th, &lh} {
+		for i := 0; i < 256; i += 2 {
+			dst = append(dst, h.len[i]|h.len[i+1]<<4)
+		}
+	}
+	w := bitWriter{b: dst}
+	for i := 0; i < len(tokens); {
+		tag := tokens[i]
+		if tag == 0 {
+			i++
+			continue
+		}
+		w.write(th.code[tag], th.len[tag])
+		i++
+		if tag < 0x20 {
+			l := int(tag)
+			if tag == smallLit+1 {
+				w.write(uint16(tokens[i]), 8)
+				l += int(tokens[i])
+				i++
+			}
+			for _, c := range tokens[i : i+l] {
+				w.write(lh.code[c], lh.len[c])
+			}
+			i += l
+		} else {
+			w.write(uint16(tokens[i]), 8)
+			i++
+			if tag>>4 == smallCopy-1 {
+				w.write(uint16(tokens[i]), 8)
+				i++
+			}
+		}
+	}
+	return w.flush()
+}
+
+/*
+huffDecode appends ulen bytes decoded from src to dst. Copies could refer
+to dst bytes after base. Errors are *CorruptError with offset in src.
+*/
+func huffDecode(dst, src []byte, base, ulen int) ([]byte, error) {
+	if len(src) < 2*huffTableSize {
+		return dst, &CorruptError{Offset: int64(len(src))}
+	}
+	var th, lh huffCode
+	for i, c := range src[:2*huffTableSize] {
+		if c&15 > huffMaxBits || c>>4 > huffMaxBits {
+			return dst, &CorruptError{Offset: int64(i)}
+		}
+		h, j := &th, 2*i
+		if i >= huffTableSize {
+			h, j = &lh, j-2*huffTableSize
+		}
+		h.len[j], h.len[j+1] = c&15, c>>4
+	}
+	var tt, lt huffTable
+	if !tt.build(&th) {
+		return dst, &CorruptError{Offset: 0}
+	}
+	if !lt.build(&lh) {
+		return dst, &CorruptError{Offset: huffTableSize}
+	}
+	r := bitReader{b: src[2*huffTableSize:]}
+	end := len(dst) + ulen
+	for len(dst) < end {
+		/* offset of bits is not exact, it points to byte being read */
+		start := len(src) - len(r.b)
+		tag := r.decode(&tt)
+		if tag <= 0 {
+			return dst, &CorruptError{Offset: int64(start)}
+		}
+		if tag < 0x20 {
+			l := tag
+			if tag == smallLit+1 {
+				l += int(r.byte())
+			}
+			if len(dst)+l > end {
+				return dst, &CorruptError{Offset: int64(start)}
+			}
+			for ; l > 0; l-- {
+				c := r.decode(&lt)
+				if c < 0 {
+					return dst, &CorruptError{Offset: int64(start)}
+				}
+				dst = append(dst, byte(c))
+			}
+		} else {
+			off := (tag&0x0f)<<8 | int(r.byte()) + 1
+			l := tag>>4 + 2
+			if tag>>4 == smallCopy-1 {
+				l += int(r.byte())
+			}
+			if off > len(dst)-base || len(dst)+l > end {
+				return dst, &CorruptError{Offset: int64(start)}
+			}
+			for ; l > 0; l-- {
+				dst = append(dst, dst[len(dst)-off])
+			}
+		}
+		if r.overrun() {
+			return dst, &CorruptError{Offset: int64(start)}
+		}
+	}
+	if r.overrun() || len(r.b) != 0 || r.n-r.pad >= 8 {
+		return dst, &CorruptError{Offset: int64(len(src) - len(r.b))}
+	}
+	return dst, nil
+}
@@ -0,0 +1,95 @@
+package funlz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestHuffCode(t *testing.T) {
+	var freq [256]int32
+	/* fibonacci frequencies give the deepest tree */
+	a, b := int32(1), int32(1)
+	for i := 0; i < 40; i++ {
+		freq[i] = a
+		a, b = b, a+b
+	}
+	var h huffCode
+	h.build(&freq)
+	kraft := 0
+	for s, l := range h.len {
+		if (l == 0) != (freq[s] == 0) || l > huffMaxBits {
+			t.Fatalf("symbol %d: length %d", s, l)
+		}
+		if l != 0 {
+			kraft += 1 << (huffMaxBits - l)
+		}
+	}
+	if kraft != 1<<huffMaxBits {
+		t.Errorf("code is not complete: %d", kraft)
+	}
+}
+
+func TestFrameHuffman(t *testing.T) {
+	o := FrameOptions{Checksum: true, Huffman: true}
+	c := frameCompress(original, o)
+	d, err := frameDecompress(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := eq(original, d); p != -1 {
+		t.Fatalf("not equal at %d", p)
+	}
+	o.Huffman = false
+	plain := frameCompress(original, o)
+	t.Logf("orig/plain/huffman %d/%d/%d", len(original), len(plain), len(c))
+	if len(c) >= len(plain)*9/10 {
+		t.Errorf("huffman is not 10%% better: %d >= %d", len(c), len(plain))
+	}
+
+	/* tiny segments are kept as tokens */
+	var out bytes.Buffer
+	f, _ := NewFrameWriterOptions(&out, FrameOptions{Huffman: true})
+	for i := 0; i < 10; i++ {
+		f.Write([]byte("hello, hello"))
+		f.Flush()
+	}
+	f.Close()
+	if d, err = frameDecompress(out.Bytes()); err != nil || string(d) != string(bytes.Repeat([]byte("hello, hello"), 10)) {
+		t.Errorf("small segments: %q %v", d, err)
+	}
+}
+
+func TestFrameHuffmanCorrupt(t *testing.T) {
+	c := frameCompress(original[:100000], FrameOptions{Huffman: true})
+	rnd := uint32(1)
+	for i := 0; i < 500; i++ {
+		rnd = rnd*1103515245 + 12345
+		b := append([]byte(nil), c...)
+		b[int(rnd>>8)%len(b)] ^= byte(rnd>>24) | 1
+		if i%2 == 0 {
+			b = b[:int(rnd>>4)%len(b)]
+		}
+		f, err := NewFrameReader(bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		/* without checksum corruption could pass, but it should not panic */
+		ioutil.ReadAll(f)
+	}
+}
+
+func BenchmarkFrameHuffmanCompressBig(b *testing.B) {
+	o := FrameOptions{Checksum: true, Huffman: true}
+	for i := 0; i < b.N; i++ {
+		frameCompress(original, o)
+	}
+}
+
+func BenchmarkFrameHuffmanDecompressBig(b *testing.B) {
+	c := frameCompress(original, FrameOptions{Checksum: true, Huffman: true})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frameDecompress(c)
+	}
+}
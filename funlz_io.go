@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"io"
 	"log"
+	"time"
 )
 
 var _ = log.Print
@@ -21,6 +22,16 @@ const (
 	hashsize  = 1 << hashlog
 )
 
+/*
+after skipStart positions without match, every next search skips
+(misses-skipStart)>>skipLog more positions, but not more than maxSkip
+*/
+const (
+	skipStart = 32
+	skipLog   = 5
+	maxSkip   = 256
+)
+
 /* mostly random const needed to compute hash */
 const somemagicconst = 0x53215229
 
@@ -40,46 +51,125 @@ Output stream is not checksumed. Flush is marked with zero byte.
 	comp.Flush()
 */
 type Writer struct {
-	w  writeAndByteWriter
+	encoder
 	bw *bufio.Writer
 
 	wself      bool
+	out        io.Writer /* wrapped writer */
+	closeOut   bool      /* Close closes out */
 	err        error
-	upos, wpos int32               /* uncompressed pos and write pos in raw buffer */
-	last       uint32              /* last 4 chars */
-	litlen     int32               /* lengh of last literal */
-	hash       [hashsize]positions /* hash of positions */
-	raw        [buffer]byte        /* input buffer */
+	upos, wpos int32        /* uncompressed pos and write pos in raw buffer */
+	mpos       int32        /* wpos at last flush mark */
+	raw        [buffer]byte /* input buffer */
+	dict       *Dictionary
+}
+
+/*
+encoder is a matcher and token emitter shared by Writer and Compress.
+Input is addressed as raw[pos&mask], so Writer passes its ring buffer with
+mask buffer-1 and Compress passes source slice with all bits set.
+*/
+type encoder struct {
+	sink   TokenSink
+	wire   wireSink            /* sink of Writer and Compress */
+	lit    [maxLit]byte        /* literal crossing end of ring buffer */
+	last   uint32              /* last 4 chars */
+	litlen int32               /* lengh of last literal */
+	miss   int32               /* positions searched without match */
+	hash   [hashsize]positions /* hash of positions */
+
+	/* runtime tunables, see Options */
+	shift      uint32      /* 32 - hashlog */
+	tab        hashTable   /* hash of positions if not default hashlog/backref */
+	finder     MatchFinder /* used instead of hash if set */
+	hashcopy   bool
+	lookbehind bool
+	lazy       int32    /* how many next positions are checked for longer match */
+	skip       bool     /* step faster through long literals */
+	opt        *optimal /* buffers of optimal parse, if it is enabled */
+	stats      *Stats   /* nil unless EnableStats */
 }
 
 // NewWriter wraps io.Writer into Writer
 func NewWriter(wr io.Writer) (w *Writer) {
 	w = &Writer{}
+	w.setOptions(Options{})
+	w.Reset(wr)
+	return w
+}
+
+// Reset discards Writer state and makes it write to wr, so Writer could be reused
+// without allocation. Options are kept.
+// Unwritten data is dropped, so call Flush before Reset if it is needed.
+func (w *Writer) Reset(wr io.Writer) {
+	w.out = wr
 	if wb, ok := wr.(writeAndByteWriter); ok {
-		w.w = wb
+		w.wire.w = wb
 	} else {
-		w.bw = bufio.NewWriter(wr)
-		w.w = w.bw
+		if w.bw == nil {
+			w.bw = bufio.NewWriter(wr)
+		} else {
+			w.bw.Reset(wr)
+		}
+		w.wire.w = w.bw
 	}
-	return w
+	w.sink = &w.wire
+	w.clear()
+	w.err = nil
+	if w.stats != nil {
+		*w.stats = Stats{}
+	}
+}
+
+/* wireSink encodes tokens into format described in doc.go */
+type wireSink struct {
+	w writeAndByteWriter
 }
 
-func (w *Writer) byte2(b1, b2 byte) (err error) {
-	if err = w.w.WriteByte(b1); err == nil {
-		err = w.w.WriteByte(b2)
+func (s *wireSink) byte2(b1, b2 byte) (err error) {
+	if err = s.w.WriteByte(b1); err == nil {
+		err = s.w.WriteByte(b2)
 	}
 	return
 }
 
-func (w *Writer) byte3(b1, b2, b3 byte) (err error) {
-	if err = w.w.WriteByte(b1); err == nil {
-		if err = w.w.WriteByte(b2); err == nil {
-			err = w.w.WriteByte(b3)
+func (s *wireSink) byte3(b1, b2, b3 byte) (err error) {
+	if err = s.w.WriteByte(b1); err == nil {
+		if err = s.w.WriteByte(b2); err == nil {
+			err = s.w.WriteByte(b3)
 		}
 	}
 	return
 }
 
+func (s *wireSink) Literal(t Literal) (err error) {
+	l := len(t.Data)
+	if l <= smallLit {
+		err = s.w.WriteByte(byte(l))
+	} else {
+		err = s.byte2((smallLit + 1), byte(l-(smallLit+1)))
+	}
+	if err == nil {
+		_, err = s.w.Write(t.Data)
+	}
+	return
+}
+
+func (s *wireSink) Copy(t Copy) (err error) {
+	off, l := t.Offset-1, t.Length
+	hi, lo := byte(off>>8), byte(off)
+	if l <= smallCopy {
+		err = s.byte2(byte((l-2)<<4)|hi, lo)
+	} else {
+		err = s.byte3((smallCopy+1-2)<<4|hi, lo, byte(l-(smallCopy+1))) /* 0xf0|hi , l-17 */
+	}
+	return
+}
+
+func (s *wireSink) Flush() error {
+	return s.w.WriteByte(0)
+}
+
 const wmask = 0x7f /* window mask */
 
 // Write provides io.Writer
@@ -158,22 +248,51 @@ func (w *Writer) WriteByte(b byte) (err error) {
 }
 
 func (w *Writer) compress() (err error) {
-	last := w.last
-	upos, wpos := w.upos, w.wpos
-	litlen := w.litlen
+	var start time.Time
+	if w.stats != nil {
+		start = time.Now()
+	}
+	w.upos, err = w.encoder.compress(w.raw[:], buffer-1, w.upos, w.wpos)
+	w.err = err
+	if w.stats != nil {
+		w.stats.Time += time.Since(start)
+	}
+	return
+}
+
+// compress emits tokens for raw[upos:wpos] and returns new upos.
+// On error returned position points to start of unwritten literal.
+func (e *encoder) compress(raw []byte, mask, upos, wpos int32) (_ int32, err error) {
+	if e.opt != nil {
+		return e.compressOptimal(raw, mask, upos, wpos)
+	}
+	last := e.last
+	litlen := e.litlen
+	miss, skip := e.miss, e.skip
+	/* default hash is used directly, find and insert are not inlined */
+	fixed := e.finder == nil && e.tab.table == nil
 	for upos < wpos {
-		cur := w.raw[upos%buffer]
+		cur := raw[upos&mask]
 		last = (last << 8) | uint32(cur)
-		h := (last * somemagicconst) >> (32 - hashlog)
+		h := (last * somemagicconst) >> e.shift
 		if litlen < minCopy-1 {
 			upos++
 			if upos >= minCopy {
-				w.hash[h].push(upos)
+				if fixed {
+					e.hash[h].push(upos)
+				} else {
+					e.insert(raw, mask, upos, wpos, last, h)
+				}
 			}
 			litlen++
 			continue
 		}
-		poses := &w.hash[h]
+		var poses []int32
+		if fixed {
+			poses = e.hash[h][:]
+		} else {
+			poses = e.find(raw, mask, upos+1, wpos, last, h)
+		}
 		m := struct{ l, p, cut int32 }{0, 0, 0}
 		var wind int32
 		if upos > window {
@@ -184,26 +303,29 @@ func (w *Writer) compress() (err error) {
 		var lastAtP uint32
 		var p, pb, pe, ub, ue, lim int32
 		{
+			if len(poses) == 0 {
+				goto LoopEnd
+			}
 			p = poses[0]
 			if p-minCopy < wind {
 				goto LoopEnd
 			}
-			if w.raw[(p-1)%buffer] != cur {
+			if raw[(p-1)&mask] != cur {
 				goto Loop
 			}
-			lastAtP = uint32(cur) | uint32(w.raw[(p-2)%buffer])<<8 |
-				uint32(w.raw[(p-3)%buffer])<<16 | uint32(w.raw[(p-4)%buffer])<<24
+			lastAtP = uint32(cur) | uint32(raw[(p-2)&mask])<<8 |
+				uint32(raw[(p-3)&mask])<<16 | uint32(raw[(p-4)&mask])<<24
 			if lastAtP != last {
 				goto Loop
 			}
 			pe, ue = p, upos+1
-			if lookbehind {
+			if e.lookbehind {
 				pb, ub = p-5, upos-4
 				lim = p - litlen
 				if lim < wind {
 					lim = wind
 				}
-				for pb > lim && w.raw[pb%buffer] == w.raw[ub%buffer] {
+				for pb > lim && raw[pb&mask] == raw[ub&mask] {
 					pb--
 					ub--
 				}
@@ -216,7 +338,7 @@ func (w *Writer) compress() (err error) {
 			if lim > wpos {
 				lim = wpos
 			}
-			for ue < lim && w.raw[pe%buffer] == w.raw[ue%buffer] {
+			for ue < lim && raw[pe&mask] == raw[ue&mask] {
 				ue++
 				pe++
 			}
@@ -231,22 +353,22 @@ func (w *Writer) compress() (err error) {
 			if p-minCopy < wind {
 				break
 			}
-			if w.raw[(p-1)%buffer] != cur {
+			if raw[(p-1)&mask] != cur {
 				continue
 			}
-			lastAtP = uint32(cur) | uint32(w.raw[(p-2)%buffer])<<8 |
-				uint32(w.raw[(p-3)%buffer])<<16 | uint32(w.raw[(p-4)%buffer])<<24
+			lastAtP = uint32(cur) | uint32(raw[(p-2)&mask])<<8 |
+				uint32(raw[(p-3)&mask])<<16 | uint32(raw[(p-4)&mask])<<24
 			if lastAtP != last {
 				continue
 			}
 			pe, ue = p, upos+1
-			if lookbehind {
+			if e.lookbehind {
 				pb, ub = p-5, upos-4
 				lim = p - litlen
 				if lim < wind {
 					lim = wind
 				}
-				for pb > lim && w.raw[pb%buffer] == w.raw[ub%buffer] {
+				for pb > lim && raw[pb&mask] == raw[ub&mask] {
 					pb--
 					ub--
 				}
@@ -259,7 +381,7 @@ func (w *Writer) compress() (err error) {
 			if lim > wpos {
 				lim = wpos
 			}
-			for ue < lim && w.raw[pe%buffer] == w.raw[ue%buffer] {
+			for ue < lim && raw[pe&mask] == raw[ue&mask] {
 				ue++
 				pe++
 			}
@@ -270,131 +392,254 @@ func (w *Writer) compress() (err error) {
 			}
 		}
 	LoopEnd:
+		if e.lazy != 0 && m.l >= minCopy && m.l < maxCopy &&
+			e.lazier(raw, mask, upos, wpos, last, m.l-m.cut+minCopy, litlen+1-m.cut) {
+			/* emit current byte as literal, and match from next one */
+			m.l = 0
+		}
 		upos++
-		poses.push(upos)
+		if fixed {
+			e.hash[h].push(upos)
+		} else {
+			e.insert(raw, mask, upos, wpos, last, h)
+		}
 		litlen++
 		if m.l < minCopy {
-			if litlen == maxLit+minCopy {
-				if err = w.emitLit(upos-litlen, maxLit); err != nil {
+			if skip && miss >= skipStart {
+				n := (miss - skipStart) >> skipLog
+				if n > maxSkip {
+					n = maxSkip
+				}
+				if n > wpos-upos {
+					n = wpos - upos
+				}
+				if n > 0 {
+					upos += n
+					litlen += n
+					last = uint32(raw[(upos-4)&mask])<<24 |
+						uint32(raw[(upos-3)&mask])<<16 |
+						uint32(raw[(upos-2)&mask])<<8 |
+						uint32(raw[(upos-1)&mask])
+				}
+				miss += n
+			}
+			miss++
+			if litlen >= maxLit+minCopy {
+				/* keep minCopy bytes for lookbehind of next match */
+				n := litlen - minCopy
+				n -= n % maxLit
+				if err = e.emitLit(raw, mask, upos-litlen, n); err != nil {
 					upos -= litlen
 					litlen = 0
 					break
 				}
-				litlen = minCopy
+				litlen -= n
 			}
 		} else {
+			miss = 0
 			if litlen > m.cut {
-				if err = w.emitLit(upos-litlen, litlen-m.cut); err != nil {
+				if err = e.emitLit(raw, mask, upos-litlen, litlen-m.cut); err != nil {
 					upos -= litlen
 					litlen = 0
 					break
 				}
 			}
 			litlen = 0
-			if err = w.emitCopy(upos-m.cut-m.p, m.l); err != nil {
+			if err = e.emitCopy(upos-m.cut-m.p, m.l); err != nil {
 				break
 			}
-			if hashcopy {
+			if e.hashcopy {
 				for i := m.l - m.cut; i != 0; i-- {
-					last = (last << 8) | uint32(w.raw[upos%buffer])
-					h = (last * somemagicconst) >> (32 - hashlog)
+					last = (last << 8) | uint32(raw[upos&mask])
+					h = (last * somemagicconst) >> e.shift
 					upos++
-					w.hash[h].push(upos)
+					if fixed {
+						e.hash[h].push(upos)
+					} else {
+						e.insert(raw, mask, upos, wpos, last, h)
+					}
 				}
 			} else {
 				upos += m.l - m.cut
-				last = uint32(w.raw[(upos-4)%buffer])<<24 |
-					uint32(w.raw[(upos-3)%buffer])<<16 |
-					uint32(w.raw[(upos-2)%buffer])<<8 |
-					uint32(w.raw[(upos-1)%buffer])
-				hh := (last * somemagicconst) >> (32 - hashlog)
+				last = uint32(raw[(upos-4)&mask])<<24 |
+					uint32(raw[(upos-3)&mask])<<16 |
+					uint32(raw[(upos-2)&mask])<<8 |
+					uint32(raw[(upos-1)&mask])
+				hh := (last * somemagicconst) >> e.shift
 				if h != hh {
-					w.hash[hh].push(upos)
+					if fixed {
+						e.hash[hh].push(upos)
+					} else {
+						e.insert(raw, mask, upos, wpos, last, hh)
+					}
 				}
 			}
 		}
 	}
-	w.upos = upos
-	w.litlen = litlen
-	w.last = last
-	w.err = err
-	return
+	e.litlen = litlen
+	e.last = last
+	e.miss = miss
+	return upos, err
 }
 
-func (w *Writer) emitLit(pos, l int32) (err error) {
-	if l <= smallLit {
-		if err = w.w.WriteByte(byte(l)); err != nil {
+func (e *encoder) emitLit(raw []byte, mask, pos, l int32) (err error) {
+	/* literal left at flush could be up to maxLit+minCopy-1 long */
+	for l > maxLit {
+		if err = e.emitLit(raw, mask, pos, maxLit); err != nil {
 			return
 		}
-	} else {
-		if err = w.byte2((smallLit + 1), byte(l-(smallLit+1))); err != nil {
+		pos += maxLit
+		l -= maxLit
+	}
+	if e.stats != nil {
+		e.stats.literal(l)
+		e.stats.Compressed += int64(l) + 1
+		if l > smallLit {
+			e.stats.Compressed++
+		}
+	}
+	rpos := pos & mask
+	if rpos+l <= int32(len(raw)) {
+		return e.sink.Literal(Literal{Data: raw[rpos : rpos+l]})
+	}
+	n := copy(e.lit[:], raw[rpos:])
+	copy(e.lit[n:l], raw)
+	return e.sink.Literal(Literal{Data: e.lit[:l]})
+}
+
+func (e *encoder) emitCopy(off, l int32) (err error) {
+	if e.stats != nil {
+		e.stats.copy(off, l)
+		e.stats.Compressed += 2
+		if l > smallCopy {
+			e.stats.Compressed++
+		}
+	}
+	return e.sink.Copy(Copy{Offset: int(off), Length: int(l)})
+}
+
+// finish emits literal pending before upos and flush mark.
+func (e *encoder) finish(raw []byte, mask, upos int32) (err error) {
+	if e.litlen > 0 {
+		err = e.emitLit(raw, mask, upos-e.litlen, e.litlen)
+		e.litlen = 0
+		if err != nil {
 			return
 		}
 	}
-	rpos := pos % buffer
-	var n int
-	if rpos+l <= buffer {
-		_, err = w.w.Write(w.raw[rpos : rpos+l])
-	} else if n, err = w.w.Write(w.raw[rpos:]); err == nil {
-		_, err = w.w.Write(w.raw[:int(l)-n])
+	// flush mark
+	if e.stats != nil {
+		e.stats.Flushes++
+		e.stats.Compressed++
 	}
-	return
+	return e.sink.Flush()
 }
 
-func (w *Writer) emitCopy(off, l int32) (err error) {
-	off--
-	hi, lo := byte(off>>8), byte(off)
-	if l <= smallCopy {
-		err = w.byte2(byte((l-2)<<4)|hi, lo)
+// reset clears matcher state, so following tokens do not refer before it.
+func (e *encoder) reset() {
+	if e.finder != nil {
+		e.finder.Reset()
+	} else if e.tab.table != nil {
+		e.tab.Reset()
 	} else {
-		err = w.byte3((smallCopy+1-2)<<4|hi, lo, byte(l-(smallCopy+1))) /* 0xf0|hi , l-17 */
+		e.hash = [hashsize]positions{}
 	}
-	return
+	e.litlen = 0
+	e.miss = 0
+	e.last = 0
 }
 
+/* flush compresses pending data, writes flush mark and clears state */
 func (w *Writer) flush() error {
 	if w.upos != w.wpos {
-		panic("flush upos != wpos")
-	}
-	if w.litlen > 0 {
-		w.err = w.emitLit(w.upos-w.litlen, w.litlen)
-		w.litlen = 0
-		if w.err != nil {
-			return w.err
+		if err := w.compress(); err != nil {
+			return err
 		}
 	}
-	// flush mark
-	w.err = w.w.WriteByte(0)
-	if w.bw != nil {
-		w.bw.Flush()
+	if w.err = w.finish(w.raw[:], buffer-1, w.upos); w.err != nil {
+		return w.err
 	}
-	/* clear state */
-	for i := range w.hash {
-		p := &w.hash[i]
-		for j := range p {
-			p[j] = 0
+	if w.bw != nil {
+		if w.err = w.bw.Flush(); w.err != nil {
+			return w.err
 		}
 	}
+	w.clear()
+	return nil
+}
+
+/* clear state, so next segment is decodable by itself */
+func (w *Writer) clear() {
+	w.reset()
 	w.upos = 0
 	w.wpos = 0
-	w.litlen = 0
-	w.last = 0
-	return w.err
+	if w.dict != nil {
+		w.primeDict(w.dict)
+		w.wpos = int32(copy(w.raw[:], w.dict.data))
+		w.upos = w.wpos
+	}
+	/* start of stream is a boundary as well as flush mark */
+	w.mpos = w.wpos
 }
 
 // Flush writes all unwritten data to output. Returns error encounted during writting.
+// It is the same as FlushFull.
 func (w *Writer) Flush() (err error) {
+	return w.FlushFull()
+}
+
+// FlushFull writes all unwritten data to output and clears compression state,
+// so following data is decodable by itself, ie Reader could start from it.
+func (w *Writer) FlushFull() (err error) {
 	if w.err != nil {
 		return w.err
 	}
+	return w.flush()
+}
+
+// FlushSync writes all unwritten data to output, but keeps compression history,
+// so following data could refer to data written before. It gives better compression
+// for stream of small messages, but following data could be decoded only by
+// Reader which has read all previous data.
+// Reader restores Dictionary at every flush mark, so with Dictionary it is FlushFull.
+func (w *Writer) FlushSync() (err error) {
+	if w.err != nil {
+		return w.err
+	}
+	if w.dict != nil {
+		return w.FlushFull()
+	}
 	if err = w.compress(); err != nil {
 		return
 	}
-	return w.flush()
+	if w.err = w.finish(w.raw[:], buffer-1, w.upos); w.err != nil {
+		return w.err
+	}
+	w.mpos = w.wpos
+	if w.bw != nil {
+		w.err = w.bw.Flush()
+	}
+	return w.err
 }
 
+// Close flushes unwritten data, following calls of Writer return ErrClosed
+// until Reset. It closes wrapped writer only if Options.CloseWriter is set.
+// Raw stream has no end marker, stream just ends with flush mark, which Reader
+// checks in strict mode. FrameWriter writes trailer.
 func (w *Writer) Close() (err error) {
-	return w.Flush()
+	if w.err == ErrClosed {
+		return nil
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if c, ok := w.out.(io.Closer); ok && w.closeOut {
+		if w.err = c.Close(); w.err != nil {
+			return w.err
+		}
+	}
+	w.err = ErrClosed
+	return nil
 }
 
 type readAndByteReader interface {
@@ -408,46 +653,111 @@ Input is tested to have ReadByte method. If it has no, then input is wrapped int
 */
 type Reader struct {
 	r          readAndByteReader
+	br         *bufio.Reader
 	err        error
 	rpos, wpos int32
+	hist       int32        /* length of valid history, up to window */
+	cpos       int64        /* compressed bytes read */
 	raw        [buffer]byte /* uncompressed data */
+	dict       *Dictionary
+	redict     bool  /* dictionary should be restored after flush mark */
+	eom        bool  /* last tag was flush mark */
+	msgs       bool  /* Read stops at flush marks, see NextMessage */
+	mpos       int64 /* rpos at start of message */
+	maxMsg     int64 /* limit of message size */
+	strict     bool  /* stream should end with flush mark */
+	recovery   bool  /* skip corrupt data, see SetRecovery */
+	skipped    []SkippedRange
+	lim        Limits
+	limited    bool  /* lim is not zero */
+	total, seg int64 /* decoded bytes since Reset and since flush mark, if limited */
+	stats      *Stats
 }
 
 // NewReader wraps io.Reader into Reader
 // If input provides ReadByte, then it is not wrapped by bufio.Reader
 func NewReader(rd io.Reader) (r *Reader) {
 	r = &Reader{}
+	r.Reset(rd)
+	return
+}
+
+// Reset discards Reader state and makes it read from rd, so Reader could be reused
+// without allocation. bufio.Reader allocated for previous input is reused as well.
+func (r *Reader) Reset(rd io.Reader) {
 	if rb, ok := rd.(readAndByteReader); ok {
 		r.r = rb
 	} else {
-		r.r = bufio.NewReader(rd)
+		if r.br == nil {
+			r.br = bufio.NewReader(rd)
+		} else {
+			r.br.Reset(rd)
+		}
+		r.r = r.br
+	}
+	r.err = nil
+	r.rpos = 0
+	r.wpos = 0
+	r.hist = 0
+	r.cpos = 0
+	r.redict = r.dict != nil
+	r.eom = true
+	r.msgs = false
+	r.mpos = 0
+	r.skipped = nil
+	r.total = 0
+	r.seg = 0
+	if r.stats != nil {
+		*r.stats = Stats{}
 	}
-	return
 }
 
-func (r *Reader) Close() error {
-	if r.err == io.EOF {
-		return nil
-	}
-	return r.err
+// Close returns error encountered during reading, if it is not io.EOF,
+// so in strict mode it reports stream which is not ended with flush mark.
+// Following reads return ErrClosed until Reset.
+func (r *Reader) Close() (err error) {
+	if r.err != io.EOF && r.err != ErrClosed {
+		err = r.err
+	}
+	r.err = ErrClosed
+	r.rpos = r.wpos
+	return
 }
 
 // Read provides io.Reader
 func (r *Reader) Read(b []byte) (bytes int, err error) {
-	if r.err != nil {
-		return 0, r.err
+	if r.redict && r.rpos == r.wpos {
+		r.restoreDict()
 	}
 	n := int32(window / 2)
 	if int(n) > len(b)+64 {
 		n = int32(len(b)) + 64
 	}
 	npos := r.rpos + n
-	for r.wpos < npos && err == nil {
-		if err = r.readTag(); err != nil {
+	var start time.Time
+	if r.stats != nil {
+		start = time.Now()
+	}
+	for r.wpos < npos && r.err == nil {
+		if err = r.readTag(); err == io.ErrNoProgress {
 			break
+		} else if err != nil {
+			/* error is returned after all decoded data */
+			r.err = err
 		}
 	}
+	if r.stats != nil {
+		r.stats.Time += time.Since(start)
+	}
 	l := r.wpos - r.rpos
+	if r.maxMsg > 0 && r.msgs && l > 0 {
+		if left := r.maxMsg - (int64(r.rpos) - r.mpos); int64(l) > left {
+			if left == 0 {
+				return 0, &TooLargeError{Offset: r.cpos, Limit: r.maxMsg}
+			}
+			l = int32(left)
+		}
+	}
 	if l > 0 {
 		if len(b) < int(l) {
 			l = int32(len(b))
@@ -462,94 +772,225 @@ func (r *Reader) Read(b []byte) (bytes int, err error) {
 		}
 		b = b[l:]
 		r.rpos += l
-		if r.rpos == wrapsize {
-			r.rpos = 0
-			r.wpos = 0
-		}
+		r.rebase()
 	}
-	if err == io.ErrNoProgress {
-		err = nil
+	err = nil
+	if r.rpos == r.wpos {
+		err = r.drained()
 	}
-	r.err = err
 	return int(l), err
 }
 
+// SetStrict enables strict mode: stream should end with flush mark, ie with Flush or
+// Close of Writer, otherwise Reader returns *TruncatedError instead of io.EOF.
+// errors.Is(err, io.ErrUnexpectedEOF) reports it. Mode is kept by Reset.
+func (r *Reader) SetStrict(strict bool) {
+	r.strict = strict
+}
+
+/* rebase keeps positions small, ring indexes are not changed */
+func (r *Reader) rebase() {
+	if r.rpos >= wrapsize {
+		r.rpos -= wrapsize
+		r.wpos -= wrapsize
+		r.mpos -= wrapsize
+	}
+}
+
+/* drained returns error to report when all decoded data is consumed */
+func (r *Reader) drained() error {
+	if r.msgs && r.err != ErrClosed {
+		if r.eom {
+			return io.EOF
+		}
+		if r.err == io.EOF {
+			return &TruncatedError{Offset: r.cpos}
+		}
+	}
+	return r.err
+}
+
 // ReadByte provides io.ByteReader
 func (r *Reader) ReadByte() (b byte, err error) {
-	if r.err != nil {
-		return 0, r.err
-	}
 	if r.wpos == r.rpos {
+		if err = r.drained(); err != nil {
+			return 0, err
+		}
 	Retry:
-		if err = r.readTag(); err != nil {
+		if r.redict {
+			r.restoreDict()
+		}
+		if r.stats == nil {
+			err = r.readTag()
+		} else {
+			start := time.Now()
+			err = r.readTag()
+			r.stats.Time += time.Since(start)
+		}
+		if err != nil {
 			if err == io.ErrNoProgress {
+				if r.msgs && r.eom {
+					return 0, io.EOF
+				}
 				goto Retry
 			}
 			r.err = err
-			return
+			return 0, r.drained()
 		}
 	}
+	if r.maxMsg > 0 && r.msgs && int64(r.rpos)-r.mpos >= r.maxMsg {
+		return 0, &TooLargeError{Offset: r.cpos, Limit: r.maxMsg}
+	}
 	b = r.raw[r.rpos%buffer]
 	r.rpos++
-	if r.rpos == wrapsize {
-		r.rpos = 0
-		r.wpos = 0
+	r.rebase()
+	return
+}
+
+/* restoreDict puts dictionary as history, data before it is dropped */
+func (r *Reader) restoreDict() {
+	r.wpos = int32(copy(r.raw[:], r.dict.data))
+	r.rpos = r.wpos
+	r.hist = r.wpos
+	r.redict = false
+}
+
+/* headerLen returns length of header of token started with tag, see doc.go */
+func headerLen(tag byte) int {
+	if tag < 0x20 {
+		if tag == smallLit+1 {
+			return 2
+		}
+		return 1
+	}
+	if tag>>4 == smallCopy-1 {
+		return 3
+	}
+	return 2
+}
+
+/*
+parseHeader decodes header of token: tag and up to two following bytes b1, b2.
+n is length of header, l is length of literal or copy and off is copy offset.
+Flush mark has l == 0, literal has off == 0 and its l bytes follow header.
+Every decoder of the format uses it.
+*/
+func parseHeader(tag, b1, b2 byte) (l, off int32, n int) {
+	if tag < 0x20 {
+		if tag == smallLit+1 {
+			return int32(tag) + int32(b1), 0, 2
+		}
+		return int32(tag), 0, 1
+	}
+	off = (int32(tag&0x0f)<<8 | int32(b1)) + 1
+	if tag>>4 == smallCopy-1 {
+		return smallCopy + 1 + int32(b2), off, 3
 	}
+	return int32(tag>>4) + 2, off, 2
+}
+
+/*
+readHeader reads rest of header of token started with tag at compressed
+offset start, and parses it. n is length of header, error of br is returned
+as *TruncatedError.
+*/
+func readHeader(br readAndByteReader, tag byte, start int64) (l, off int32, n int, err error) {
+	var b1, b2 byte
+	if n = headerLen(tag); n > 1 {
+		if b1, err = br.ReadByte(); err == nil && n > 2 {
+			b2, err = br.ReadByte()
+		}
+		if err != nil {
+			return 0, 0, 0, truncated(err, start)
+		}
+	}
+	l, off, n = parseHeader(tag, b1, b2)
 	return
 }
 
 func (r *Reader) readTag() (err error) {
-	var tag, add, low byte
-	var l int32
-	tag, err = r.r.ReadByte()
+	if r.redict || r.msgs && r.eom {
+		/* let caller to consume data before flush mark */
+		return io.ErrNoProgress
+	}
+	start := r.cpos
+	tag, err := r.r.ReadByte()
+	if err != nil {
+		if err == io.EOF && r.strict && !r.eom {
+			err = &TruncatedError{Offset: r.cpos}
+		}
+		return
+	}
+	l, off, n, err := readHeader(r.r, tag, start)
 	if err != nil {
 		return
 	}
-	if tag == 0 {
+	r.cpos += int64(n)
+	if l == 0 {
 		/* flush mark */
+		r.redict = r.dict != nil
+		r.eom = true
+		if r.recovery {
+			/* segment should not refer before flush mark */
+			r.hist = 0
+		}
+		r.seg = 0
+		if r.stats != nil {
+			r.stats.Flushes++
+		}
 		return io.ErrNoProgress
 	}
-	if tag < 0x20 {
+	r.eom = false
+	if off == 0 {
 		/* literal */
-		l = int32(tag)
-		if tag == smallLit+1 {
-			add, err = r.r.ReadByte()
-			if err != nil {
+		if r.limited {
+			if err = r.limit(l, start); err != nil {
 				return
 			}
-			l += int32(add)
 		}
 		p := r.wpos % buffer
 		if p+l <= buffer {
 			if _, err = io.ReadFull(r.r, r.raw[p:p+l]); err != nil {
-				return
+				return truncated(err, start)
 			}
 		} else {
-			var n int
-			if n, err = io.ReadFull(r.r, r.raw[p:]); err != nil {
-				return
+			var k int
+			if k, err = io.ReadFull(r.r, r.raw[p:]); err != nil {
+				return truncated(err, start)
 			}
-			if _, err = io.ReadFull(r.r, r.raw[:int(l)-n]); err != nil {
-				return
+			if _, err = io.ReadFull(r.r, r.raw[:int(l)-k]); err != nil {
+				return truncated(err, start)
 			}
 		}
+		r.cpos += int64(l)
 		r.wpos += l
+		if r.stats != nil {
+			r.stats.literal(l)
+		}
+		if r.hist += l; r.hist > window {
+			r.hist = window
+		}
 	} else {
-		low, err = r.r.ReadByte()
-		if err != nil {
-			return
+		if off > r.hist {
+			/* refers before start of stream or dictionary */
+			if r.recovery {
+				return r.resync(&CorruptError{Offset: start})
+			}
+			return &CorruptError{Offset: start}
 		}
-		off := (int32((tag&0x0f))<<8 | int32(low)) + 1
-		l = int32((tag >> 4) + 2)
-		if tag>>4 == smallCopy-1 {
-			add, err = r.r.ReadByte()
-			if err != nil {
+		if r.limited {
+			if err = r.limit(l, start); err != nil {
 				return
 			}
-			l += int32(add)
+		}
+		if r.stats != nil {
+			r.stats.copy(off, l)
+		}
+		if r.hist += l; r.hist > window {
+			r.hist = window
 		}
 		p := r.wpos % buffer
-		f := (r.wpos - off) % buffer
+		f := (r.wpos - off + buffer) % buffer
 		for off < l {
 			r.copyN(f, p, off)
 			l -= off
@@ -0,0 +1,76 @@
+package funlz
+
+/*
+Lazy matching: before emitting copy, Writer checks positions next to current
+one, and if match there saves more, current byte is emitted as literal.
+*/
+
+/*
+lazyGain is how many bytes more later match should save. Greedy parse often
+covers the gain of later match with following copy, so small gain doesn't pay.
+*/
+const lazyGain = 2
+
+/*
+lazier reports if match found for 4 bytes ending at q+1 or q+2 saves more
+than match of length cur started at q-3. pending is length of literal
+which will be emitted before current match.
+*/
+func (e *encoder) lazier(raw []byte, mask, q, wpos int32, last uint32, cur, pending int32) bool {
+	save := copySaves(cur) + lazyGain
+	if pending == 0 {
+		/* skipped bytes will need literal header */
+		save++
+	}
+	for i := int32(1); i <= e.lazy && q+i < wpos; i++ {
+		last = (last << 8) | uint32(raw[(q+i)&mask])
+		if l, _ := e.longest(raw, mask, q+i, wpos, last); copySaves(l)-i > save {
+			return true
+		}
+	}
+	return false
+}
+
+/* copySaves returns number of bytes saved by copy token of length l */
+func copySaves(l int32) int32 {
+	if l < minCopy {
+		return 0
+	} else if l <= smallCopy {
+		return l - 2
+	}
+	return l - 3
+}
+
+/*
+longest returns length and offset of longest match for 4 bytes ending at q,
+without changing state
+*/
+func (e *encoder) longest(raw []byte, mask, q, wpos int32, last uint32) (best, off int32) {
+	var wind int32
+	if q > window {
+		wind = q - window
+	}
+	lim := q - (minCopy - 1) + maxCopy
+	if lim > wpos {
+		lim = wpos
+	}
+	for _, p := range e.find(raw, mask, q+1, wpos, last, (last*somemagicconst)>>e.shift) {
+		if p-minCopy < wind {
+			break
+		}
+		lastAtP := uint32(raw[(p-1)&mask]) | uint32(raw[(p-2)&mask])<<8 |
+			uint32(raw[(p-3)&mask])<<16 | uint32(raw[(p-4)&mask])<<24
+		if lastAtP != last {
+			continue
+		}
+		pe, ue := p, q+1
+		for ue < lim && raw[pe&mask] == raw[ue&mask] {
+			ue++
+			pe++
+		}
+		if l := ue - (q - (minCopy - 1)); l > best {
+			best, off = l, q-p+1
+		}
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package funlz
+
+/*
+Limits protect Reader of untrusted input from decompression bombs: big copy
+of 3 bytes gives 272 bytes, so small input could decode to huge output.
+
+	decomp := funlz.NewReader(upload)
+	decomp.SetLimits(funlz.Limits{MaxSize: 1 << 30, MaxRatio: 20})
+
+Token which exceeds limit is not decoded, Reader returns data before it
+and then *TooLargeError with offset of the token. Its Limit is in bytes,
+for MaxRatio it is MaxRatio times compressed bytes read. Error is not
+recoverable, unlike message larger than SetMaxMessageSize, which NextMessage
+skips.
+*/
+type Limits struct {
+	// MaxSize - limit of total decompressed bytes since Reset
+	MaxSize int64
+	// MaxSegment - limit of decompressed bytes between flush marks, ie of
+	// one message or one FlushFull segment
+	MaxSegment int64
+	// MaxRatio - limit of decompressed bytes per compressed byte.
+	// It is checked after first ratioSlack bytes of output.
+	MaxRatio int64
+}
+
+/* ratioSlack is output which is not checked by MaxRatio, short streams compress well */
+const ratioSlack = 1 << 16
+
+// SetLimits sets limits of decompressed data, zero fields mean no limit.
+// Limits are kept by Reset.
+func (r *Reader) SetLimits(l Limits) {
+	r.lim = l
+	r.limited = l != Limits{}
+}
+
+/* limit checks if l more bytes of token at start exceed limits, and counts them */
+func (r *Reader) limit(l int32, start int64) error {
+	out, seg := r.total+int64(l), r.seg+int64(l)
+	switch {
+	case r.lim.MaxSize > 0 && out > r.lim.MaxSize:
+		return &TooLargeError{Offset: start, Limit: r.lim.MaxSize}
+	case r.lim.MaxSegment > 0 && seg > r.lim.MaxSegment:
+		return &TooLargeError{Offset: start, Limit: r.lim.MaxSegment}
+	case r.lim.MaxRatio > 0 && out > ratioSlack && out > r.lim.MaxRatio*r.cpos:
+		/* report bytes allowed by ratio, not ratio itself */
+		return &TooLargeError{Offset: start, Limit: r.lim.MaxRatio * r.cpos}
+	}
+	r.total, r.seg = out, seg
+	return nil
+}
@@ -0,0 +1,78 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+/* bomb is a stream of n big copies of 272 bytes after one literal byte */
+func bomb(n int) []byte {
+	c := []byte("\x01a")
+	for i := 0; i < n; i++ {
+		c = append(c, 0xf0, 0x00, 0xff)
+	}
+	return append(c, 0)
+}
+
+func TestLimits(t *testing.T) {
+	c := bomb(10000)
+	for _, l := range []Limits{{MaxSize: 100000}, {MaxSegment: 100000}, {MaxRatio: 50}} {
+		r := NewReader(bytes.NewReader(c))
+		r.SetLimits(l)
+		d, err := ioutil.ReadAll(r)
+		var te *TooLargeError
+		if !errors.As(err, &te) || !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("%+v: %v", l, err)
+		}
+		/* limit is in bytes, ratio is checked only after ratioSlack of output */
+		if n := int64(len(d)); n+maxCopy <= te.Limit || l.MaxRatio == 0 && n > te.Limit {
+			t.Errorf("%+v: limit %d after %d bytes", l, te.Limit, n)
+		}
+		if d = bytes.TrimLeft(d, "a"); len(d) != 0 {
+			t.Errorf("%+v: decoded garbage", l)
+		}
+		/* token which exceeds limit is at te.Offset */
+		if te.Offset < 2 || (te.Offset-2)%3 != 0 {
+			t.Errorf("%+v: error at %d is not at token", l, te.Offset)
+		}
+		t.Logf("%+v: %v", l, err)
+	}
+	r := NewReader(bytes.NewReader(c))
+	r.SetLimits(Limits{MaxSize: 100000})
+	d, _ := ioutil.ReadAll(r)
+	if len(d) > 100000 || len(d) < 100000-272 {
+		t.Errorf("MaxSize: decoded %d bytes", len(d))
+	}
+
+	/* ordinary streams pass, segment limit is reset at flush marks */
+	seg, _, _ := segmented(original, 1000)
+	r = NewReader(bytes.NewReader(seg))
+	r.SetLimits(Limits{MaxSize: int64(len(original)), MaxSegment: 1000, MaxRatio: 10})
+	if d, err := ioutil.ReadAll(r); err != nil || eq(original, d) != -1 {
+		t.Errorf("segmented: %v", err)
+	}
+	r.Reset(bytes.NewReader(seg))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Errorf("limits after Reset: %v", err)
+	}
+	r.Reset(bytes.NewReader(compressed))
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("segment of %d bytes: %v", len(original), err)
+	}
+	r.SetLimits(Limits{})
+	r.Reset(bytes.NewReader(c))
+	if d, err := ioutil.ReadAll(r); err != nil || len(d) != 1+272*10000 {
+		t.Errorf("without limits: %d %v", len(d), err)
+	}
+}
+
+func BenchmarkDecompressBigLimits(b *testing.B) {
+	r := NewReader(nil)
+	r.SetLimits(Limits{MaxSize: 1 << 30, MaxRatio: 100})
+	for i := 0; i < b.N; i++ {
+		r.Reset(bytes.NewReader(compressed))
+		ioutil.ReadAll(r)
+	}
+}
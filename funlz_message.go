@@ -0,0 +1,132 @@
+package funlz
+
+import (
+	"io"
+)
+
+/*
+Messages: every flush mark ends a message, so stream of messages is just
+a stream with flush after each of them.
+
+	comp.WriteMessage(msg1)
+	comp.WriteMessage(msg2)
+	...
+	for {
+		msg, err := decomp.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		...
+	}
+*/
+
+// MaxMessageSize is the largest message WriteMessage accepts.
+const MaxMessageSize = 1 << 27
+
+// WriteMessage writes b as a single message: data followed by flush mark.
+// History is kept as with FlushSync. Data written with Write and not flushed
+// yet becomes start of the message. Message larger than MaxMessageSize
+// gives *TooLargeError.
+func (w *Writer) WriteMessage(b []byte) (err error) {
+	if w.err != nil {
+		return w.err
+	}
+	size := int64(w.wpos-w.mpos) + int64(len(b))
+	if size > MaxMessageSize {
+		return &TooLargeError{Offset: -1, Limit: MaxMessageSize}
+	}
+	if int64(w.wpos)+int64(len(b)) >= wrapsize {
+		/* Write would put flush mark inside the message, so history is cleared now */
+		if w.wpos != w.mpos {
+			if w.dict != nil {
+				/* Reader restores dictionary only at flush mark */
+				return &TooLargeError{Offset: -1, Limit: int64(wrapsize - w.mpos)}
+			}
+			if err = w.compress(); err != nil {
+				return
+			}
+			if w.litlen > 0 {
+				if w.err = w.emitLit(w.raw[:], buffer-1, w.upos-w.litlen, w.litlen); w.err != nil {
+					return w.err
+				}
+			}
+		}
+		mpos := w.wpos - w.mpos
+		w.clear()
+		/* Reader history is not reset, so pending part stays in the message */
+		w.mpos -= mpos
+	}
+	if _, err = w.Write(b); err != nil {
+		return
+	}
+	return w.FlushSync()
+}
+
+// SetMaxMessageSize limits size of message returned by ReadMessage and read
+// after NextMessage. Larger message gives *TooLargeError, and following
+// NextMessage skips it. Zero means no limit.
+func (r *Reader) SetMaxMessageSize(n int64) {
+	r.maxMsg = n
+}
+
+// NextMessage skips the rest of current message and switches Reader into
+// message mode: Read returns io.EOF at the end of message, and
+// *TruncatedError if stream ends inside of it.
+// NextMessage returns io.EOF if stream ended after previous message.
+func (r *Reader) NextMessage() error {
+	r.msgs = true
+	for !r.eom {
+		r.rpos = r.wpos
+		r.rebase()
+		if r.err != nil {
+			return r.drained()
+		}
+		if r.redict {
+			r.restoreDict()
+		}
+		if err := r.readTag(); err != nil && err != io.ErrNoProgress {
+			r.err = err
+		}
+	}
+	r.rpos = r.wpos
+	r.rebase()
+	if r.err != nil {
+		return r.err
+	}
+	if r.redict {
+		r.restoreDict()
+	}
+	r.eom = false
+	r.mpos = int64(r.rpos)
+	/* first tag shows if there is a message */
+	if err := r.readTag(); err != nil && err != io.ErrNoProgress {
+		r.err = err
+		if err == io.EOF {
+			/* no more messages */
+			r.eom = true
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns next message in a new slice.
+// It returns io.EOF if stream ended after previous message.
+func (r *Reader) ReadMessage() ([]byte, error) {
+	if err := r.NextMessage(); err != nil {
+		return nil, err
+	}
+	msg := []byte{}
+	for {
+		if len(msg) == cap(msg) {
+			msg = append(msg, 0)[:len(msg)]
+		}
+		n, err := r.Read(msg[len(msg):cap(msg)])
+		msg = msg[:len(msg)+n]
+		if err == io.EOF {
+			return msg, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
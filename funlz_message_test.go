@@ -0,0 +1,139 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func messages() [][]byte {
+	var msgs [][]byte
+	for i := 0; i < len(original); i += 1000 * (i%7 + 1) {
+		j := i + 100*(i%13)
+		if j > len(original) {
+			j = len(original)
+		}
+		msgs = append(msgs, original[i:j])
+		if i%3 == 0 {
+			msgs = append(msgs, nil)
+		}
+	}
+	return msgs
+}
+
+func writeMessages(w *Writer, msgs [][]byte) {
+	for _, m := range msgs {
+		if err := w.WriteMessage(m); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	msgs := messages()
+	dict := NewDictionary(original[:4096])
+	for _, d := range []*Dictionary{nil, dict} {
+		var out bytes.Buffer
+		writeMessages(NewWriterDict(&out, d), msgs)
+		r := NewReaderDict(bytes.NewReader(out.Bytes()), d)
+		for i, m := range msgs {
+			got, err := r.ReadMessage()
+			if err != nil {
+				t.Fatalf("message %d: %v", i, err)
+			}
+			if len(got) != len(m) || eq(got, m) != -1 {
+				t.Fatalf("message %d: differs", i)
+			}
+		}
+		if _, err := r.ReadMessage(); err != io.EOF {
+			t.Fatalf("no EOF after messages: %v", err)
+		}
+
+		/* NextMessage skips rest of message, ReadByte stops at its end */
+		r = NewReaderDict(bytes.NewReader(out.Bytes()), d)
+		for i, m := range msgs {
+			if err := r.NextMessage(); err != nil {
+				t.Fatalf("message %d: %v", i, err)
+			}
+			if i%2 == 0 {
+				continue
+			}
+			for j := range m {
+				if b, err := r.ReadByte(); err != nil || b != m[j] {
+					t.Fatalf("message %d byte %d: %v", i, j, err)
+				}
+			}
+			if _, err := r.ReadByte(); err != io.EOF {
+				t.Fatalf("message %d: no EOF: %v", i, err)
+			}
+		}
+		if err := r.NextMessage(); err != io.EOF {
+			t.Fatalf("no EOF after messages: %v", err)
+		}
+	}
+}
+
+func TestMessagesAfterRead(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.Write([]byte("stream "))
+	w.WriteMessage([]byte("data"))
+	w.WriteMessage([]byte("next"))
+	r := NewReader(&out)
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := r.ReadMessage()
+	if err != nil || string(msg) != "next" {
+		t.Fatalf("%q %v", msg, err)
+	}
+}
+
+func TestMessageTruncated(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.WriteMessage([]byte("first"))
+	w.Write(original[:100])
+	w.FlushSync()
+	c := out.Bytes()
+	r := NewReader(bytes.NewReader(c[:len(c)-1]))
+	if msg, err := r.ReadMessage(); err != nil || string(msg) != "first" {
+		t.Fatalf("%q %v", msg, err)
+	}
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("truncated message: %v", err)
+	}
+	/* without message mode stream is read as before */
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(c[:len(c)-1]))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	writeMessages(w, [][]byte{original[:100], original[:1000], original[:101], {}})
+	r := NewReader(&out)
+	r.SetMaxMessageSize(100)
+	if msg, err := r.ReadMessage(); err != nil || len(msg) != 100 {
+		t.Fatalf("%d %v", len(msg), err)
+	}
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("large message: %v", err)
+	}
+	if err := r.NextMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("large message: %v", err)
+	}
+	if msg, err := r.ReadMessage(); err != nil || len(msg) != 0 {
+		t.Fatalf("%d %v", len(msg), err)
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Fatal(err)
+	}
+}
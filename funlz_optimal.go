@@ -0,0 +1,192 @@
+package funlz
+
+/*
+Optimal parse: Writer finds longest match at every position of a block, and
+then chooses tokens with least total size by dynamic programming:
+	literal of len<=30 costs len+1, literal of len<=286 costs len+2,
+	copy of len<=16 costs 2, copy of len<=272 costs 3.
+Copy cost doesn't depend on offset, so only longest match is needed for every
+position: its prefixes give all shorter copies.
+*/
+
+/* size of block parsed at once */
+const optimalBlock = window
+
+/* optimal keeps buffers for optimal parse between calls */
+type optimal struct {
+	mlen, moff []int32  /* longest match at position of block */
+	cost       []int32  /* least cost of block prefix */
+	prev, off  []int32  /* last token of least cost prefix, off == 0 for literal */
+	short      minQueue /* literal starts for len 1..smallLit */
+	long       minQueue /* literal starts for len smallLit+1..maxLit */
+	tokens     []int32  /* ends of chosen tokens in reverse order */
+}
+
+/* minQueue is a sliding window minimum of cost[j]-j */
+type minQueue struct {
+	j    []int32
+	head int
+}
+
+func (q *minQueue) reset() {
+	q.j = q.j[:0]
+	q.head = 0
+}
+
+func (q *minQueue) push(j int32, cost []int32) {
+	for len(q.j) > q.head && cost[q.j[len(q.j)-1]]-q.j[len(q.j)-1] >= cost[j]-j {
+		q.j = q.j[:len(q.j)-1]
+	}
+	q.j = append(q.j, j)
+}
+
+/* min returns start with least cost[j]-j, which is not less than from, or -1 */
+func (q *minQueue) min(from int32) int32 {
+	for q.head < len(q.j) && q.j[q.head] < from {
+		q.head++
+	}
+	if q.head == len(q.j) {
+		return -1
+	}
+	return q.j[q.head]
+}
+
+func (o *optimal) init(n int32) {
+	if int32(cap(o.cost)) < n+1 {
+		o.mlen = make([]int32, n+1)
+		o.moff = make([]int32, n+1)
+		o.cost = make([]int32, n+1)
+		o.prev = make([]int32, n+1)
+		o.off = make([]int32, n+1)
+	}
+	o.mlen, o.moff = o.mlen[:n+1], o.moff[:n+1]
+	o.cost, o.prev, o.off = o.cost[:n+1], o.prev[:n+1], o.off[:n+1]
+	o.short.reset()
+	o.long.reset()
+	o.tokens = o.tokens[:0]
+}
+
+/*
+compressOptimal emits tokens for raw[upos:wpos] parsed by blocks. Literals
+at the end of block are left pending in e.litlen and parsed again with next
+block, as compress does, so literal run is split only by maxLit.
+*/
+func (e *encoder) compressOptimal(raw []byte, mask, upos, wpos int32) (_ int32, err error) {
+	for upos < wpos {
+		n := wpos - upos
+		if n > optimalBlock {
+			n = optimalBlock
+		}
+		if err = e.parseBlock(raw, mask, upos, n, wpos); err != nil {
+			return upos - e.litlen, err
+		}
+		upos += n
+	}
+	if upos >= minCopy {
+		e.last = uint32(raw[(upos-4)&mask])<<24 | uint32(raw[(upos-3)&mask])<<16 |
+			uint32(raw[(upos-2)&mask])<<8 | uint32(raw[(upos-1)&mask])
+	}
+	return upos, nil
+}
+
+/* parseBlock parses pending literal and n bytes from b */
+func (e *encoder) parseBlock(raw []byte, mask, b, n, wpos int32) (err error) {
+	o := e.opt
+	p := e.litlen
+	b -= p
+	n += p
+	o.init(n)
+	/* find longest matches, positions are put into hash as in compress */
+	last := e.last
+	for i := int32(0); i < n; i++ {
+		q := b + i
+		o.mlen[i] = 0
+		if i < p {
+			/* pending literal is already in hash */
+			continue
+		}
+		last = (last << 8) | uint32(raw[q&mask])
+		if q < minCopy-1 {
+			continue
+		}
+		if i >= minCopy-1 {
+			s := i - (minCopy - 1)
+			l, off := e.longest(raw, mask, q, wpos, last)
+			if l > n-s {
+				l = n - s
+			}
+			if l > o.mlen[s] {
+				o.mlen[s], o.moff[s] = l, off
+			}
+		}
+		e.insert(raw, mask, q+1, wpos, last, (last*somemagicconst)>>e.shift)
+	}
+	e.last = last
+	/* least cost parse */
+	const inf = 1 << 30
+	for i := range o.cost {
+		o.cost[i] = inf
+	}
+	o.cost[0] = 0
+	for i := int32(0); i <= n; i++ {
+		if i > 0 {
+			o.short.push(i-1, o.cost)
+			if i > smallLit {
+				o.long.push(i-smallLit-1, o.cost)
+			}
+			if j := o.short.min(i - smallLit); j >= 0 && o.cost[j]+i-j+1 < o.cost[i] {
+				o.cost[i], o.prev[i], o.off[i] = o.cost[j]+i-j+1, j, 0
+			}
+			if j := o.long.min(i - maxLit); j >= 0 && o.cost[j]+i-j+2 < o.cost[i] {
+				o.cost[i], o.prev[i], o.off[i] = o.cost[j]+i-j+2, j, 0
+			}
+		}
+		if i == n {
+			break
+		}
+		m := o.mlen[i]
+		if m > maxCopy {
+			m = maxCopy
+		}
+		for l := int32(minCopy); l <= m; l++ {
+			c := o.cost[i] + 2
+			if l > smallCopy {
+				c++
+			}
+			if c < o.cost[i+l] {
+				o.cost[i+l], o.prev[i+l], o.off[i+l] = c, i, o.moff[i]
+			}
+		}
+	}
+	for i := n; i > 0; i = o.prev[i] {
+		o.tokens = append(o.tokens, i)
+	}
+	/* trailing literals stay pending, so literal run is split only by maxLit */
+	m := 0
+	for m < len(o.tokens) && o.off[o.tokens[m]] == 0 {
+		m++
+	}
+	o.tokens = o.tokens[m:]
+	start := int32(0)
+	for k := len(o.tokens) - 1; k >= 0; k-- {
+		end := o.tokens[k]
+		if o.off[end] == 0 {
+			err = e.emitLit(raw, mask, b+start, end-start)
+		} else {
+			err = e.emitCopy(o.off[end], end-start)
+		}
+		if err != nil {
+			return
+		}
+		start = end
+	}
+	if l := n - start; l >= maxLit {
+		l -= l % maxLit
+		if err = e.emitLit(raw, mask, b+start, l); err != nil {
+			return
+		}
+		start += l
+	}
+	e.litlen = n - start
+	return
+}
@@ -0,0 +1,185 @@
+package funlz
+
+import (
+	"fmt"
+	"io"
+)
+
+/*
+Options tunes Writer at runtime. Zero value means constants from doc.go,
+which use fixed size hash table and are the fastest path.
+
+	comp, err := funlz.NewWriterOptions(my_sock, funlz.Options{HashLog: 12, BackRef: 4})
+*/
+type Options struct {
+	// HashLog - number of buckets in backreference hash is pow(2,HashLog)
+	HashLog int
+	// BackRef - number of positions kept in each hash bucket
+	BackRef int
+	// HashCopy - put reference to copied bytes or skip it
+	HashCopy bool
+	// LookBehind - look back from matched position
+	LookBehind bool
+	// Lazy - check if match started 1 or 2 bytes later saves more before emitting copy.
+	// With default hash it gives 1% better compression for 50-80% more time
+	// (see BenchmarkCompressBigLazy1). With LookBehind it is rarely useful.
+	Lazy int
+	// NoSkip - search match at every position of long literal. By default search
+	// steps faster and faster after 32 positions without match, so incompressible
+	// data is passed almost as fast as memcpy, but some matches could be missed.
+	NoSkip bool
+	// Optimal - choose tokens by least cost parse instead of greedy matching.
+	// It is about 8 times slower than level 9 and gives 4% smaller output. Lazy, HashCopy
+	// and LookBehind are ignored. Reader speed is not affected.
+	Optimal bool
+	// Finder - makes MatchFinder for every Writer. If it is set, HashLog and
+	// BackRef are ignored. See NewHashChain and NewBinaryTree.
+	Finder func() MatchFinder
+	// Dict - preset dictionary restored after every flush
+	Dict *Dictionary
+	// CloseWriter - Close closes wrapped writer, if it implements io.Closer
+	CloseWriter bool
+}
+
+/* limits for Options */
+const (
+	minHashLog = 8
+	maxHashLog = 20
+	maxBackRef = 16
+	maxLazy    = 2
+)
+
+/* levels are similar to compress/flate ones */
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1
+	// MaxCompression uses optimal parse, it is much slower than BestCompression
+	MaxCompression = 10
+)
+
+var levels = [...]Options{
+	1:  {HashLog: hashlog, BackRef: backref, HashCopy: hashcopy, LookBehind: lookbehind},
+	2:  {HashLog: 12, BackRef: 1},
+	3:  {HashLog: 11, BackRef: 2},
+	4:  {HashLog: 12, BackRef: 2},
+	5:  {HashLog: 12, BackRef: 2, LookBehind: true},
+	6:  {HashLog: 12, BackRef: 4},
+	7:  {HashLog: 12, BackRef: 4, LookBehind: true, NoSkip: true},
+	8:  {LookBehind: true, NoSkip: true, Finder: chainFinder(14, 16)},
+	9:  {HashCopy: true, LookBehind: true, NoSkip: true, Finder: chainFinder(14, 64)},
+	10: {Optimal: true, Finder: treeFinder(14, 32)},
+}
+
+func chainFinder(hashLog, depth int) func() MatchFinder {
+	return func() MatchFinder { return NewHashChain(hashLog, depth) }
+}
+
+func treeFinder(hashLog, depth int) func() MatchFinder {
+	return func() MatchFinder { return NewBinaryTree(hashLog, depth) }
+}
+
+// LevelOptions returns Options for compression level from BestSpeed to MaxCompression.
+// DefaultCompression gives zero Options.
+func LevelOptions(level int) (o Options, err error) {
+	if level == DefaultCompression {
+		return
+	}
+	if level < BestSpeed || level > MaxCompression {
+		return o, fmt.Errorf("funlz: invalid compression level: %d", level)
+	}
+	return levels[level], nil
+}
+
+func (o Options) check() error {
+	if o.HashLog != 0 && (o.HashLog < minHashLog || o.HashLog > maxHashLog) {
+		return fmt.Errorf("funlz: HashLog %d is not in [%d, %d]", o.HashLog, minHashLog, maxHashLog)
+	}
+	if o.BackRef < 0 || o.BackRef > maxBackRef {
+		return fmt.Errorf("funlz: BackRef %d is not in [1, %d]", o.BackRef, maxBackRef)
+	}
+	if o.Lazy < 0 || o.Lazy > maxLazy {
+		return fmt.Errorf("funlz: Lazy %d is not in [0, %d]", o.Lazy, maxLazy)
+	}
+	return nil
+}
+
+// NewWriterOptions wraps io.Writer into Writer tuned with Options
+func NewWriterOptions(wr io.Writer, o Options) (*Writer, error) {
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	w := &Writer{dict: o.Dict, closeOut: o.CloseWriter}
+	w.setOptions(o)
+	w.Reset(wr)
+	return w, nil
+}
+
+// NewWriterLevel wraps io.Writer into Writer with compression level
+func NewWriterLevel(wr io.Writer, level int) (*Writer, error) {
+	o, err := LevelOptions(level)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterOptions(wr, o)
+}
+
+/* setOptions expects checked Options */
+func (e *encoder) setOptions(o Options) {
+	if o.HashLog == 0 {
+		o.HashLog = hashlog
+	}
+	if o.BackRef == 0 {
+		o.BackRef = backref
+	}
+	e.shift = uint32(32 - o.HashLog)
+	e.hashcopy = o.HashCopy
+	e.lookbehind = o.LookBehind
+	e.lazy = int32(o.Lazy)
+	e.skip = !o.NoSkip
+	e.opt = nil
+	if o.Optimal {
+		e.opt = &optimal{}
+	}
+	e.finder = nil
+	e.tab = hashTable{}
+	if o.Finder != nil {
+		e.finder = o.Finder()
+	} else if o.HashLog != hashlog || o.BackRef != backref {
+		e.tab = *NewHashFinder(o.HashLog, o.BackRef).(*hashTable)
+	}
+}
+
+// bucket returns positions stored for hash h, most recent first
+func (e *encoder) bucket(h uint32) []int32 {
+	if e.tab.table == nil {
+		return e.hash[h][:]
+	}
+	return e.tab.bucket(h)
+}
+
+// push stores position u into bucket for hash h
+func (e *encoder) push(h uint32, u int32) {
+	if e.tab.table == nil {
+		e.hash[h].push(u)
+		return
+	}
+	e.tab.push(h, u)
+}
+
+/* find returns candidates for 4 bytes last ending before pos, h is their hash */
+func (e *encoder) find(raw []byte, mask, pos, end int32, last, h uint32) []int32 {
+	if e.finder == nil {
+		return e.bucket(h)
+	}
+	return e.finder.Find(raw, mask, pos, end, last)
+}
+
+/* insert remembers pos of 4 bytes last, h is their hash */
+func (e *encoder) insert(raw []byte, mask, pos, end int32, last, h uint32) {
+	if e.finder == nil {
+		e.push(h, pos)
+		return
+	}
+	e.finder.Insert(raw, mask, pos, end, last)
+}
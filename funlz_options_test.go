@@ -0,0 +1,259 @@
+package funlz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func compressOptions(in []byte, o Options) []byte {
+	var out bytes.Buffer
+	c, err := NewWriterOptions(&out, o)
+	if err != nil {
+		panic(err)
+	}
+	c.Write(in)
+	c.Flush()
+	return out.Bytes()
+}
+
+func TestOptionsDefault(t *testing.T) {
+	o := Options{HashLog: hashlog, BackRef: backref, HashCopy: hashcopy, LookBehind: lookbehind}
+	if p := eq(compressed, compressOptions(original, o)); p != -1 {
+		t.Errorf("explicit default options differ from NewWriter at %d", p)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	for level := BestSpeed; level <= MaxCompression; level++ {
+		var out bytes.Buffer
+		c, err := NewWriterLevel(&out, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Write(original)
+		c.Flush()
+		if p := eq(original, decompress(out.Bytes())); p != -1 {
+			t.Errorf("level %d: not equal at %d", level, p)
+		}
+		t.Logf("level %d: orig/comp %d/%d", level, len(original), out.Len())
+	}
+}
+
+func TestLazy(t *testing.T) {
+	opts := []Options{{Lazy: 1}, {Lazy: 2}, {HashLog: 12, BackRef: 4, Lazy: 1}, {HashLog: 12, BackRef: 4, Lazy: 2, LookBehind: true}}
+	for _, o := range opts {
+		c := compressOptions(original, o)
+		if p := eq(original, decompress(c)); p != -1 {
+			t.Errorf("%+v: not equal at %d", o, p)
+		}
+		t.Logf("%+v: orig/comp %d/%d", o, len(original), len(c))
+		if o.LookBehind {
+			/* lookbehind already finds most of lazy matches */
+			continue
+		}
+		o.Lazy = 0
+		if greedy := compressOptions(original, o); len(c) >= len(greedy) {
+			t.Errorf("%+v: lazy is not better %d >= %d", o, len(c), len(greedy))
+		}
+	}
+}
+
+func TestSkip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	in := make([]byte, 100000)
+	rnd.Read(in)
+	in = append(in, original[:100000]...)
+	for _, o := range []Options{{}, {HashLog: 12, BackRef: 4}, {NoSkip: true}} {
+		c := compressOptions(in, o)
+		if p := eq(in, decompress(c)); p != -1 {
+			t.Errorf("%+v: not equal at %d", o, p)
+		}
+		t.Logf("%+v: orig/comp %d/%d", o, len(in), len(c))
+		/* random bytes are skipped, but following text is matched */
+		if len(c) > len(in)-40000 {
+			t.Errorf("%+v: compressed %d bytes", o, len(c))
+		}
+	}
+	/* skipping costs little on compressible data */
+	n := len(compressOptions(original, Options{NoSkip: true}))
+	t.Logf("orig/comp %d/%d, without skip %d", len(original), len(compressed), n)
+	if c := len(compressed); c > n+n/200 {
+		t.Errorf("skipping makes output %d larger than %d", c, n)
+	}
+}
+
+func BenchmarkCompressRandom(b *testing.B) {
+	benchmarkCompressRandom(b, Options{})
+}
+
+func BenchmarkCompressRandomNoSkip(b *testing.B) {
+	benchmarkCompressRandom(b, Options{NoSkip: true})
+}
+
+func benchmarkCompressRandom(b *testing.B, o Options) {
+	rnd := rand.New(rand.NewSource(1))
+	in := make([]byte, 1<<20)
+	rnd.Read(in)
+	c, _ := NewWriterOptions(nil, o)
+	b.SetBytes(int64(len(in)))
+	for i := 0; i < b.N; i++ {
+		c.Reset(ioutil.Discard)
+		c.Write(in)
+		c.Flush()
+	}
+}
+
+func TestOptionsInvalid(t *testing.T) {
+	for _, o := range []Options{{HashLog: 4}, {HashLog: 30}, {BackRef: -1}, {BackRef: 100}, {Lazy: 3}} {
+		if _, err := NewWriterOptions(nil, o); err == nil {
+			t.Errorf("%+v: no error", o)
+		}
+	}
+	for _, l := range []int{0, 11, -2} {
+		if _, err := NewWriterLevel(nil, l); err == nil {
+			t.Errorf("level %d: no error", l)
+		}
+	}
+}
+
+func TestLevelSizes(t *testing.T) {
+	n1 := len(compressOptions(original, levels[BestSpeed]))
+	n2 := len(compressOptions(original, levels[BestSpeed+1]))
+	t.Logf("level 1: %d, level 2: %d", n1, n2)
+	if n2 >= n1 {
+		t.Errorf("level 2 is not better than level 1: %d >= %d", n2, n1)
+	}
+}
+
+/* level 1 should be faster than level 2, compare their ns/op */
+func BenchmarkCompressBigLevel1(b *testing.B) {
+	benchmarkCompressBigLevel(b, BestSpeed)
+}
+
+func BenchmarkCompressBigLevel2(b *testing.B) {
+	benchmarkCompressBigLevel(b, BestSpeed+1)
+}
+
+func benchmarkCompressBigLevel(b *testing.B, level int) {
+	o, _ := LevelOptions(level)
+	b.SetBytes(int64(len(original)))
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, o)
+	}
+}
+
+func BenchmarkCompressBigLevel9(b *testing.B) {
+	o, _ := LevelOptions(BestCompression)
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, o)
+	}
+}
+
+func TestOptimal(t *testing.T) {
+	o, _ := LevelOptions(MaxCompression)
+	c := compressOptions(original, o)
+	if p := eq(original, decompress(c)); p != -1 {
+		t.Fatalf("not equal at %d", p)
+	}
+	if best := compressOptions(original, levels[BestCompression]); len(c) >= len(best) {
+		t.Errorf("optimal is not better than level 9: %d >= %d", len(c), len(best))
+	}
+	/* small writes and sync flushes split input into short calls */
+	var out bytes.Buffer
+	w, _ := NewWriterOptions(&out, Options{Optimal: true, Dict: NewDictionary(original[:5000])})
+	for i := 0; i < len(original); i += 1000 {
+		j := i + 1000
+		if j > len(original) {
+			j = len(original)
+		}
+		w.Write(original[i:j])
+		if i%3000 == 0 {
+			w.FlushSync()
+		}
+	}
+	w.Close()
+	r := NewReaderDict(bytes.NewReader(out.Bytes()), NewDictionary(original[:5000]))
+	var res bytes.Buffer
+	if _, err := res.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if p := eq(original, res.Bytes()); p != -1 {
+		t.Errorf("with dictionary: not equal at %d", p)
+	}
+	if d, err := Decompress(nil, c); err != nil || eq(original, d) != -1 {
+		t.Errorf("Decompress differs: %v", err)
+	}
+}
+
+func TestOptimalRandom(t *testing.T) {
+	o, _ := LevelOptions(MaxCompression)
+	rnd := rand.New(rand.NewSource(1))
+	b := make([]byte, 100000)
+	rnd.Read(b)
+	c := compressOptions(b, o)
+	if max := MaxCompressedLen(len(b)); len(c) > max {
+		t.Errorf("compressed %d bytes, expected at most %d", len(c), max)
+	}
+	if p := eq(b, decompress(c)); p != -1 {
+		t.Errorf("not equal at %d", p)
+	}
+	/* segments should not exceed MaxCompressedLen, or FrameReader rejects them */
+	d, err := frameDecompress(frameCompress(b, FrameOptions{Options: o}))
+	if err != nil || eq(b, d) != -1 {
+		t.Errorf("frame: %v", err)
+	}
+}
+
+func BenchmarkCompressBigMax(b *testing.B) {
+	o, _ := LevelOptions(MaxCompression)
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, o)
+	}
+}
+
+func TestBackRefDepths(t *testing.T) {
+	for br := 1; br <= maxBackRef; br++ {
+		for _, o := range []Options{{HashLog: minHashLog}, {HashLog: 12, HashCopy: true, LookBehind: true}} {
+			o.BackRef = br
+			c := compressOptions(original, o)
+			if p := eq(original, decompress(c)); p != -1 {
+				t.Errorf("%+v: not equal at %d", o, p)
+			}
+		}
+	}
+}
+
+func TestPositionsPush(t *testing.T) {
+	var p positions
+	for u := int32(1); u <= backref+2; u++ {
+		p.push(u)
+		for i := range p {
+			if want := u - int32(i); want > 0 && p[i] != want || want <= 0 && p[i] != 0 {
+				t.Fatalf("after push %d: %v", u, p)
+			}
+		}
+	}
+}
+
+func TestPushPos(t *testing.T) {
+	for depth := 2; depth <= maxBackRef; depth++ {
+		/* bucket in the middle of table, neighbours should not change */
+		table := make([]int32, 3*depth)
+		p := table[depth : 2*depth]
+		for u := int32(1); u <= int32(depth)+2; u++ {
+			pushPos(p, u)
+			for i := range p {
+				if want := u - int32(i); want > 0 && p[i] != want || want <= 0 && p[i] != 0 {
+					t.Fatalf("depth %d: after push %d: %v", depth, u, p)
+				}
+			}
+		}
+		for i, v := range table {
+			if (i < depth || i >= 2*depth) && v != 0 {
+				t.Fatalf("depth %d: push changed neighbour bucket: %v", depth, table)
+			}
+		}
+	}
+}
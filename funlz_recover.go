@@ -0,0 +1,174 @@
+package funlz
+
+import (
+	"io"
+)
+
+/*
+Recovery: Writer.FlushFull clears matcher state, so tokens after such flush
+mark never refer before it. Reader in recovery mode uses it: copy before last
+flush mark is corrupt token, and on corrupt token Reader scans input for flush
+mark after which tokens decode without history, and continues from it.
+Data decoded before corrupt token is returned as is.
+
+	decomp.SetRecovery(true)
+	io.Copy(out, decomp)
+	for _, s := range decomp.Skipped() {
+		log.Printf("skipped %d..%d: %v", s.Start, s.End, s.Err)
+	}
+
+Stream should be written with Flush or FlushFull: segment after FlushSync
+which refers before flush mark looks corrupt in recovery mode.
+*/
+
+/* recoverCheck is how many compressed bytes after flush mark should decode */
+const recoverCheck = window
+
+// SkippedRange is a range of compressed input dropped by recovery mode
+type SkippedRange struct {
+	Start int64 // offset of corrupt token
+	End   int64 // offset after flush mark decoding resumed from, or end of input
+	Err   error // error of corrupt token
+}
+
+// SetRecovery enables recovery mode: on corrupt token Reader skips input to the
+// next plausible flush mark and continues from it instead of returning error.
+// Skipped ranges are reported by Skipped. Mode is kept by Reset.
+// Stream should not be written with FlushSync, see above.
+func (r *Reader) SetRecovery(on bool) {
+	r.recovery = on
+}
+
+// Skipped returns ranges of compressed input dropped by recovery mode since Reset
+func (r *Reader) Skipped() []SkippedRange {
+	return r.skipped
+}
+
+/* replayReader returns bytes read ahead by recovery before rest of input */
+type replayReader struct {
+	buf []byte
+	r   readAndByteReader
+}
+
+func (p *replayReader) ReadByte() (byte, error) {
+	if len(p.buf) != 0 {
+		b := p.buf[0]
+		p.buf = p.buf[1:]
+		return b, nil
+	}
+	return p.r.ReadByte()
+}
+
+func (p *replayReader) Read(b []byte) (int, error) {
+	if len(p.buf) != 0 {
+		n := copy(b, p.buf)
+		p.buf = p.buf[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+/* scanner reads input ahead into buf */
+type scanner struct {
+	r   readAndByteReader
+	buf []byte
+	err error
+}
+
+/* at returns byte k of buf, reading input if needed */
+func (s *scanner) at(k int) (byte, bool) {
+	for k >= len(s.buf) && s.err == nil {
+		var b byte
+		if b, s.err = s.r.ReadByte(); s.err == nil {
+			s.buf = append(s.buf, b)
+		}
+	}
+	if k < len(s.buf) {
+		return s.buf[k], true
+	}
+	return 0, false
+}
+
+/* plausible reports if tokens from buf[k] decode with history of hist bytes */
+func (s *scanner) plausible(k int, hist int32) bool {
+	end := k + recoverCheck
+	for k < end {
+		tag, ok := s.at(k)
+		if !ok {
+			/* end of input at token boundary */
+			return s.err == io.EOF
+		}
+		if tag == 0 {
+			return true
+		}
+		var b [2]byte
+		n := headerLen(tag)
+		for j := 1; j < n; j++ {
+			if b[j-1], ok = s.at(k + j); !ok {
+				return false
+			}
+		}
+		l, off, _ := parseHeader(tag, b[0], b[1])
+		k += n
+		if off == 0 {
+			if _, ok = s.at(k + int(l) - 1); !ok {
+				return false
+			}
+			k += int(l)
+		} else if off > hist {
+			return false
+		}
+		if hist += l; hist > window {
+			hist = window
+		}
+	}
+	return true
+}
+
+/*
+resync skips input after corrupt token to plausible flush mark, and sets
+state as after flush mark with empty history. It returns io.ErrNoProgress,
+or error of input if it ended before such flush mark.
+*/
+func (r *Reader) resync(cause *CorruptError) error {
+	var hist int32
+	if r.dict != nil {
+		hist = int32(len(r.dict.data))
+	}
+	s := scanner{r: r.r}
+	base := r.cpos /* offset of s.buf[0] */
+	for i := 0; ; i++ {
+		b, ok := s.at(i)
+		if !ok {
+			r.cpos = base + int64(len(s.buf))
+			r.skipped = append(r.skipped, SkippedRange{Start: cause.Offset, End: r.cpos, Err: cause})
+			return s.err
+		}
+		if b == 0 && s.plausible(i+1, hist) {
+			r.cpos = base + int64(i) + 1
+			r.skipped = append(r.skipped, SkippedRange{Start: cause.Offset, End: r.cpos, Err: cause})
+			r.replay(s.buf[i+1:])
+			break
+		}
+		if i >= 2*recoverCheck {
+			/* bytes before i are not needed anymore */
+			s.buf = s.buf[:copy(s.buf, s.buf[i:])]
+			base += int64(i)
+			i = 0
+		}
+	}
+	r.hist = 0
+	r.seg = 0
+	r.redict = r.dict != nil
+	r.eom = true
+	return io.ErrNoProgress
+}
+
+/* replay makes bytes read ahead to be read before rest of input */
+func (r *Reader) replay(buf []byte) {
+	if p, ok := r.r.(*replayReader); ok {
+		p.buf = append(append([]byte(nil), buf...), p.buf...)
+		return
+	}
+	r.r = &replayReader{buf: append([]byte(nil), buf...), r: r.r}
+}
@@ -0,0 +1,121 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+/* segmented compresses in by FlushFull every n bytes and returns offsets of segments */
+func segmented(in []byte, n int) (c []byte, cpos, upos []int64) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	for i := 0; i < len(in); i += n {
+		j := i + n
+		if j > len(in) {
+			j = len(in)
+		}
+		cpos = append(cpos, int64(out.Len()))
+		upos = append(upos, int64(i))
+		w.Write(in[i:j])
+		w.FlushFull()
+	}
+	return out.Bytes(), cpos, upos
+}
+
+/* corruptCopy makes first copy after compressed offset pos refer before history */
+func corruptCopy(c []byte, pos int64) Token {
+	tr := NewTokenReader(bytes.NewReader(c))
+	for {
+		tok, err := tr.Next()
+		if err != nil {
+			panic(err)
+		}
+		if tok.Pos >= pos && (tok.Kind == SmallCopy || tok.Kind == BigCopy) {
+			c[tok.Pos] |= 0x0f
+			c[tok.Pos+1] = 0xff
+			return tok
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	in := original[:100000]
+	c, cpos, upos := segmented(in, 1000)
+	for _, k := range []int{0, 10, 50, len(cpos) - 2} {
+		b := append([]byte(nil), c...)
+		tok := corruptCopy(b, cpos[k]+100)
+		/* without recovery history is kept at flush marks, so only copy in first segment is corrupt */
+		if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b))); k == 0 && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("segment %d: without recovery: %v", k, err)
+		}
+		r := NewReader(bytes.NewReader(b))
+		r.SetRecovery(true)
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("segment %d: %v", k, err)
+		}
+		/* data before corrupt token and after its segment is decoded */
+		want := append(append([]byte(nil), in[:tok.Out]...), in[upos[k+1]:]...)
+		if len(d) != len(want) || eq(want, d) != -1 {
+			t.Errorf("segment %d: decoded %d bytes, expected %d, differs at %d", k, len(d), len(want), eq(want, d))
+		}
+		s := r.Skipped()
+		if len(s) != 1 || s[0].Start != tok.Pos || s[0].End != cpos[k+1] || !errors.Is(s[0].Err, ErrCorrupt) {
+			t.Errorf("segment %d: skipped %+v, expected %d..%d", k, s, tok.Pos, cpos[k+1])
+		}
+	}
+}
+
+func TestRecoveryMany(t *testing.T) {
+	in := original[:100000]
+	c, cpos, upos := segmented(in, 1000)
+	var toks []Token
+	for k := 5; k < len(cpos)-1; k += 7 {
+		toks = append(toks, corruptCopy(c, cpos[k]))
+	}
+	r := NewReader(bytes.NewReader(c))
+	r.SetRecovery(true)
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Skipped()) != len(toks) {
+		t.Errorf("skipped %d ranges, expected %d", len(r.Skipped()), len(toks))
+	}
+	var lost int64
+	for i, k := 0, 5; k < len(cpos)-1; i, k = i+1, k+7 {
+		lost += upos[k+1] - toks[i].Out
+	}
+	if int64(len(d)) != int64(len(in))-lost {
+		t.Errorf("decoded %d bytes, expected %d", len(d), int64(len(in))-lost)
+	}
+	/* ReadByte recovers as well */
+	r.Reset(bytes.NewReader(c))
+	var n int
+	for {
+		if _, err = r.ReadByte(); err != nil {
+			break
+		}
+		n++
+	}
+	if n != len(d) || len(r.Skipped()) != len(toks) {
+		t.Errorf("ReadByte decoded %d bytes, skipped %d ranges", n, len(r.Skipped()))
+	}
+}
+
+func TestRecoveryEnd(t *testing.T) {
+	/* stream ends before next boundary */
+	c, cpos, _ := segmented(original[:3000], 1000)
+	tok := corruptCopy(c, cpos[2])
+	r := NewReader(bytes.NewReader(c[:len(c)-1]))
+	r.SetRecovery(true)
+	d, err := ioutil.ReadAll(r)
+	if err != nil || int64(len(d)) != tok.Out {
+		t.Errorf("decoded %d bytes, expected %d: %v", len(d), tok.Out, err)
+	}
+	if s := r.Skipped(); len(s) != 1 || s[0].End != int64(len(c)-1) {
+		t.Errorf("skipped %+v", s)
+	}
+}
@@ -0,0 +1,71 @@
+package funlz
+
+import (
+	"math/bits"
+	"time"
+)
+
+/*
+Stats describes token stream produced by Writer or consumed by Reader.
+Stats are collected only after EnableStats, so Writer and Reader are not
+slowed down by default.
+
+Histograms count values by powers of two: element i counts values
+from 1<<i to 1<<(i+1)-1.
+*/
+type Stats struct {
+	Uncompressed int64         // bytes before compression
+	Compressed   int64         // bytes of token stream
+	Flushes      int64         // flush marks
+	Literals     int64         // literal tokens
+	Copies       int64         // copy tokens
+	LiteralLen   [9]int64      // histogram of literal lengths, 1..286
+	CopyLen      [9]int64      // histogram of copy lengths, 4..272
+	CopyOffset   [13]int64     // histogram of copy offsets, 1..4096
+	Time         time.Duration // time spent in compression or decompression
+}
+
+func (s *Stats) literal(l int32) {
+	s.Literals++
+	s.LiteralLen[bits.Len32(uint32(l))-1]++
+	s.Uncompressed += int64(l)
+}
+
+func (s *Stats) copy(off, l int32) {
+	s.Copies++
+	s.CopyLen[bits.Len32(uint32(l))-1]++
+	s.CopyOffset[bits.Len32(uint32(off))-1]++
+	s.Uncompressed += int64(l)
+}
+
+// EnableStats makes Writer collect Stats. They are cleared by Reset.
+func (w *Writer) EnableStats() {
+	if w.stats == nil {
+		w.stats = &Stats{}
+	}
+}
+
+// Stats returns statistics collected since Reset, if EnableStats was called.
+func (w *Writer) Stats() (s Stats) {
+	if w.stats != nil {
+		s = *w.stats
+	}
+	return
+}
+
+// EnableStats makes Reader collect Stats. They are cleared by Reset.
+func (r *Reader) EnableStats() {
+	if r.stats == nil {
+		r.stats = &Stats{}
+	}
+}
+
+// Stats returns statistics collected since Reset, if EnableStats was called.
+// Compressed counts input bytes consumed so far.
+func (r *Reader) Stats() (s Stats) {
+	if r.stats != nil {
+		s = *r.stats
+		s.Compressed = r.cpos
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package funlz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func histSum(h []int64) (s int64) {
+	for _, v := range h {
+		s += v
+	}
+	return
+}
+
+func TestStats(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	if s := w.Stats(); s != (Stats{}) {
+		t.Fatalf("stats without EnableStats: %+v", s)
+	}
+	w.EnableStats()
+	w.Write(original)
+	w.FlushSync()
+	w.Write(original[:1000])
+	w.Flush()
+	ws := w.Stats()
+	if ws.Uncompressed != int64(len(original)+1000) || ws.Compressed != int64(out.Len()) || ws.Flushes != 2 {
+		t.Errorf("Writer stats: %d %d %d", ws.Uncompressed, ws.Compressed, ws.Flushes)
+	}
+	if histSum(ws.LiteralLen[:]) != ws.Literals || histSum(ws.CopyLen[:]) != ws.Copies ||
+		histSum(ws.CopyOffset[:]) != ws.Copies || ws.Copies == 0 || ws.Time <= 0 {
+		t.Errorf("Writer histograms: %+v", ws)
+	}
+
+	r := NewReader(bytes.NewReader(out.Bytes()))
+	r.EnableStats()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	rs := r.Stats()
+	ws.Time, rs.Time = 0, 0
+	if rs != ws {
+		t.Errorf("Reader stats differ:\n%+v\n%+v", rs, ws)
+	}
+	r.Reset(bytes.NewReader(out.Bytes()))
+	if rs = r.Stats(); rs.Literals != 0 || rs.Compressed != 0 {
+		t.Errorf("stats are not cleared by Reset: %+v", rs)
+	}
+}
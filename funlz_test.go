@@ -3,6 +3,7 @@ package funlz
 import (
 	"bytes"
 	"compress/flate"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -290,6 +291,26 @@ func BenchmarkCompressBig(b *testing.B) {
 	}
 }
 
+/*
+Lazy matching on GettingReal.html (412715 bytes) with default hash:
+
+	BenchmarkCompressBig       186408 bytes  5.8ms
+	BenchmarkCompressBigLazy1  184736 bytes  8.6ms
+	BenchmarkCompressBigLazy2  184248 bytes 10.6ms
+	BenchmarkFlateBig          131511 bytes  4.4ms (level 1)
+*/
+func BenchmarkCompressBigLazy1(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, Options{Lazy: 1})
+	}
+}
+
+func BenchmarkCompressBigLazy2(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		compressOptions(original, Options{Lazy: 2})
+	}
+}
+
 func BenchmarkCompressMedium(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		compressNull(original[:11111])
@@ -351,3 +372,115 @@ func BenchmarkDeflatePart(b *testing.B) {
 	u := &circDecomp{mk: func(r io.Reader) io.Reader { return flate.NewReader(r) }, b: flattedByPart}
 	decompByPart(u, b.N)
 }
+
+func TestReset(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	c := NewWriter(&out1)
+	c.Write(original[:5000])
+	c.Reset(&out2)
+	c.Write(original[:11111])
+	c.Flush()
+	if p := eq(compressed11111, out2.Bytes()); p != -1 {
+		t.Errorf("Writer after Reset differs at %d", p)
+	}
+	d := NewReader(bytes.NewReader(compressed))
+	d.Read(make([]byte, 1000))
+	d.Reset(bytes.NewReader(compressed11111))
+	o, _ := ioutil.ReadAll(d)
+	if p := eq(original[:11111], o); p != -1 {
+		t.Errorf("Reader after Reset differs at %d", p)
+	}
+}
+
+func TestResetAllocs(t *testing.T) {
+	out := bytes.NewBuffer(make([]byte, 0, 2*len(compressed11111)))
+	c := NewWriter(out)
+	in := bytes.NewReader(compressed11111)
+	d := NewReader(in)
+	buf := make([]byte, 11111)
+	allocs := testing.AllocsPerRun(10, func() {
+		out.Reset()
+		c.Reset(out)
+		c.Write(original[:11111])
+		c.Flush()
+		in.Reset(out.Bytes())
+		d.Reset(in)
+		io.ReadFull(d, buf)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per run", allocs)
+	}
+	if p := eq(original[:11111], buf); p != -1 {
+		t.Errorf("not equal at %d", p)
+	}
+}
+
+func TestFlushSync(t *testing.T) {
+	var sync, full bytes.Buffer
+	cs := NewWriter(&sync)
+	cf := NewWriter(&full)
+	var marks []int
+	for i := 0; i < 100; i++ {
+		m := original[30000+i*200 : 30000+i*200+150]
+		cs.Write(m)
+		cf.Write(m)
+		if i%10 == 9 {
+			cs.FlushFull()
+			marks = append(marks, sync.Len())
+		} else {
+			cs.FlushSync()
+		}
+		cf.FlushFull()
+	}
+	if sync.Len() >= full.Len() {
+		t.Errorf("FlushSync doesn't help %d >= %d", sync.Len(), full.Len())
+	}
+	var expect []byte
+	for i := 0; i < 100; i++ {
+		expect = append(expect, original[30000+i*200:30000+i*200+150]...)
+	}
+	if p := eq(expect, decompress(sync.Bytes())); p != -1 {
+		t.Errorf("Reader differs at %d", p)
+	}
+	if d, err := Decompress(nil, sync.Bytes()); err != nil || eq(expect, d) != -1 {
+		t.Errorf("Decompress differs: %v", err)
+	}
+	/* data after FlushFull is decodable by itself */
+	for i, m := range marks[:len(marks)-1] {
+		d, err := Decompress(nil, sync.Bytes()[m:])
+		if err != nil || eq(expect[(i+1)*1500:], d) != -1 {
+			t.Errorf("segment after full flush %d is not decodable: %v", i, err)
+		}
+	}
+}
+
+func TestReaderCorrupt(t *testing.T) {
+	cases := []struct {
+		in  string
+		off int64
+	}{
+		{"\x20\x00", 0},
+		{"\x01a\x20\x01", 2},
+		{"\x04asdf\x00\x01b\xf0\x05\x10", 8},
+		{"\x1f\x00" + string(original[:31]) + "\x2f\xff", 33},
+	}
+	for _, c := range cases {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewBufferString(c.in)))
+		if ce, ok := err.(*CorruptError); !ok || ce.Offset != c.off {
+			t.Errorf("%#v: expected corrupt at %d, got %v", c.in, c.off, err)
+		}
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%#v: %v is not ErrCorrupt", c.in, err)
+		}
+		_, err = Decompress(nil, []byte(c.in))
+		if ce, ok := err.(*CorruptError); !ok || ce.Offset != c.off {
+			t.Errorf("%#v: Decompress expected corrupt at %d, got %v", c.in, c.off, err)
+		}
+	}
+	/* copy from dictionary is not corrupt */
+	dict := NewDictionary([]byte("asdf"))
+	o, err := ioutil.ReadAll(NewReaderDict(bytes.NewBufferString("\x01b\x20\x04"), dict))
+	if err != nil || string(o) != "basdf" {
+		t.Errorf("copy from dictionary: %q %v", o, err)
+	}
+}
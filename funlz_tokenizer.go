@@ -0,0 +1,86 @@
+package funlz
+
+/*
+Tokens found by Writer's matcher. Writer encodes them as described in doc.go,
+Tokenizer passes them to TokenSink, so other encodings could be built on top
+of the same match finding.
+*/
+
+// Literal is a run of bytes not found in history, 1..286 bytes long
+type Literal struct {
+	Data []byte // valid only during TokenSink call
+}
+
+// Copy repeats Length bytes (4..272) found Offset (1..4096) bytes back.
+// Copy may overlap bytes it produces.
+type Copy struct {
+	Offset, Length int
+}
+
+// TokenSink receives tokens from Tokenizer. Error returned by it is returned
+// by Tokenizer method which produced the token.
+type TokenSink interface {
+	Literal(Literal) error
+	Copy(Copy) error
+	// Flush ends data flushed with FlushSync or FlushFull
+	Flush() error
+}
+
+// TokenSinkFunc makes TokenSink from function, tok is Literal, Copy or nil for Flush.
+type TokenSinkFunc func(tok interface{}) error
+
+func (f TokenSinkFunc) Literal(t Literal) error { return f(t) }
+func (f TokenSinkFunc) Copy(t Copy) error       { return f(t) }
+func (f TokenSinkFunc) Flush() error            { return f(nil) }
+
+/*
+Tokenizer runs Writer's matcher over written data and passes tokens to TokenSink.
+Tokens are produced same way as Writer does, so writing them in format of doc.go
+gives the same stream.
+
+	t, err := funlz.NewTokenizer(mySink, funlz.Options{})
+	t.Write(data)
+	t.FlushFull()
+*/
+type Tokenizer struct {
+	w Writer
+}
+
+// NewTokenizer returns Tokenizer tuned with Options which sends tokens to sink
+func NewTokenizer(sink TokenSink, o Options) (*Tokenizer, error) {
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	t := &Tokenizer{w: Writer{dict: o.Dict}}
+	t.w.setOptions(o)
+	t.Reset(sink)
+	return t, nil
+}
+
+// Reset discards Tokenizer state and makes it send tokens to sink.
+func (t *Tokenizer) Reset(sink TokenSink) {
+	t.w.sink = sink
+	t.w.clear()
+	t.w.err = nil
+}
+
+// Write provides io.Writer. Tokens are produced as soon as matcher finds them.
+func (t *Tokenizer) Write(b []byte) (int, error) {
+	return t.w.Write(b)
+}
+
+// WriteByte provides io.ByteWriter
+func (t *Tokenizer) WriteByte(b byte) error {
+	return t.w.WriteByte(b)
+}
+
+// FlushSync produces tokens for all written data and Flush, keeping history
+// as Writer.FlushSync does.
+func (t *Tokenizer) FlushSync() error {
+	return t.w.FlushSync()
+}
+
+// FlushFull produces tokens for all written data and Flush, and clears history.
+func (t *Tokenizer) FlushFull() error {
+	return t.w.FlushFull()
+}
@@ -0,0 +1,52 @@
+package funlz
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTokenizerWire(t *testing.T) {
+	var out bytes.Buffer
+	tk, err := NewTokenizer(&wireSink{w: &out}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk.Write(original)
+	tk.FlushFull()
+	if p := eq(compress(original), out.Bytes()); p != -1 {
+		t.Errorf("differs from Writer at %d", p)
+	}
+}
+
+func TestTokenizerFunc(t *testing.T) {
+	var out []byte
+	flushes := 0
+	sink := TokenSinkFunc(func(tok interface{}) error {
+		switch tok := tok.(type) {
+		case Literal:
+			if len(tok.Data) == 0 || len(tok.Data) > maxLit {
+				t.Fatalf("literal of %d bytes", len(tok.Data))
+			}
+			out = append(out, tok.Data...)
+		case Copy:
+			if tok.Length < minCopy || tok.Length > maxCopy || tok.Offset < 1 || tok.Offset > window || tok.Offset > len(out) {
+				t.Fatalf("bad copy %+v", tok)
+			}
+			for i := 0; i < tok.Length; i++ {
+				out = append(out, out[len(out)-tok.Offset])
+			}
+		case nil:
+			flushes++
+		}
+		return nil
+	})
+	o, _ := LevelOptions(BestCompression)
+	tk, _ := NewTokenizer(sink, o)
+	tk.Write(original)
+	tk.FlushSync()
+	tk.Write(original[:5000])
+	tk.FlushFull()
+	if p := eq(append(original[:len(original):len(original)], original[:5000]...), out); p != -1 || flushes != 2 {
+		t.Errorf("tokens differ at %d, %d flushes", p, flushes)
+	}
+}
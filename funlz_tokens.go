@@ -0,0 +1,145 @@
+package funlz
+
+import (
+	"bufio"
+	"io"
+)
+
+// TokenKind is a kind of token of compressed stream, see format in doc.go
+type TokenKind uint8
+
+const (
+	FlushMark TokenKind = iota
+	SmallLiteral
+	BigLiteral
+	SmallCopy
+	BigCopy
+)
+
+var tokenKinds = [...]string{"flush", "literal", "big literal", "copy", "big copy"}
+
+func (k TokenKind) String() string {
+	if int(k) < len(tokenKinds) {
+		return tokenKinds[k]
+	}
+	return "unknown"
+}
+
+// Token is a token of compressed stream decoded by TokenReader
+type Token struct {
+	Kind   TokenKind
+	Pos    int64  // offset of token in compressed stream
+	Out    int64  // offset of its bytes in uncompressed stream
+	Length int    // number of uncompressed bytes, 0 for flush mark
+	Offset int    // distance to copied bytes, 0 for literal and flush mark
+	Data   []byte // uncompressed bytes, valid until next call of Next
+}
+
+/*
+TokenReader reads compressed stream token by token. It is slower than Reader,
+and meant for inspecting streams.
+
+	t := funlz.NewTokenReader(f)
+	for {
+		tok, err := t.Next()
+		if err != nil {
+			break
+		}
+		fmt.Println(tok.Pos, tok.Kind, tok.Length, tok.Offset)
+	}
+*/
+type TokenReader struct {
+	r    readAndByteReader
+	dict *Dictionary
+	hist []byte /* at least window bytes of history, if there were so much */
+	cpos int64
+	upos int64
+	err  error
+}
+
+// NewTokenReader wraps io.Reader into TokenReader
+func NewTokenReader(rd io.Reader) *TokenReader {
+	return NewTokenReaderDict(rd, nil)
+}
+
+// NewTokenReaderDict wraps io.Reader into TokenReader with preset dictionary
+func NewTokenReaderDict(rd io.Reader, d *Dictionary) *TokenReader {
+	t := &TokenReader{dict: d}
+	if rb, ok := rd.(readAndByteReader); ok {
+		t.r = rb
+	} else {
+		t.r = bufio.NewReader(rd)
+	}
+	t.hist = make([]byte, 0, 2*window+maxLit)
+	t.restoreDict()
+	return t
+}
+
+func (t *TokenReader) restoreDict() {
+	if t.dict != nil {
+		t.hist = append(t.hist[:0], t.dict.data...)
+	}
+}
+
+// Next returns next token. It returns io.EOF at the end of stream,
+// *TruncatedError if stream ends inside of token and *CorruptError
+// for copy before start of stream.
+func (t *TokenReader) Next() (tok Token, err error) {
+	if t.err != nil {
+		return tok, t.err
+	}
+	defer func() {
+		if err != nil && tok.Pos != t.cpos {
+			err = truncated(err, tok.Pos)
+		}
+		t.err = err
+	}()
+	tok.Pos, tok.Out = t.cpos, t.upos
+	tag, err := t.r.ReadByte()
+	if err != nil {
+		return
+	}
+	if n := len(t.hist); n > 2*window {
+		t.hist = t.hist[:copy(t.hist, t.hist[n-window:])]
+	}
+	l, off, n, err := readHeader(t.r, tag, tok.Pos)
+	if err != nil {
+		return
+	}
+	t.cpos += int64(n)
+	tok.Length, tok.Offset = int(l), int(off)
+	switch {
+	case l == 0:
+		tok.Kind = FlushMark
+		t.restoreDict()
+		return
+	case off == 0:
+		tok.Kind = SmallLiteral
+		if n > 1 {
+			tok.Kind = BigLiteral
+		}
+		h := len(t.hist)
+		t.hist = t.hist[:h+tok.Length]
+		var k int
+		k, err = io.ReadFull(t.r, t.hist[h:])
+		t.cpos += int64(k)
+		if err != nil {
+			t.hist = t.hist[:h]
+			return
+		}
+	default:
+		tok.Kind = SmallCopy
+		if n > 2 {
+			tok.Kind = BigCopy
+		}
+		if tok.Offset > len(t.hist) {
+			return tok, &CorruptError{Offset: tok.Pos}
+		}
+		for i := 0; i < tok.Length; i++ {
+			t.hist = append(t.hist, t.hist[len(t.hist)-tok.Offset])
+		}
+	}
+	t.upos += int64(tok.Length)
+	tok.Data = t.hist[len(t.hist)-tok.Length:]
+	return
+}
@@ -0,0 +1,79 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func readTokens(t *testing.T, tr *TokenReader) (out []byte, toks []Token, err error) {
+	for {
+		tok, err := tr.Next()
+		if err != nil {
+			return out, toks, err
+		}
+		out = append(out, tok.Data...)
+		tok.Data = nil
+		toks = append(toks, tok)
+	}
+}
+
+func TestTokenReader(t *testing.T) {
+	dict := NewDictionary(original[:3000])
+	for _, d := range []*Dictionary{nil, dict} {
+		var buf bytes.Buffer
+		w := NewWriterDict(&buf, d)
+		w.Write(original)
+		w.FlushSync()
+		w.Write(original[:10000])
+		w.Flush()
+		out, toks, err := readTokens(t, NewTokenReaderDict(bytes.NewReader(buf.Bytes()), d))
+		if err != io.EOF {
+			t.Fatal(err)
+		}
+		if want := append(original[:len(original):len(original)], original[:10000]...); eq(want, out) != -1 {
+			t.Fatalf("tokens differ at %d", eq(want, out))
+		}
+		var pos, upos int64
+		for _, tok := range toks {
+			if tok.Pos != pos || tok.Out != upos {
+				t.Fatalf("%+v: expected at %d/%d", tok, pos, upos)
+			}
+			var size int64
+			switch tok.Kind {
+			case FlushMark:
+				size = 1
+			case SmallLiteral:
+				size = int64(tok.Length) + 1
+			case BigLiteral:
+				size = int64(tok.Length) + 2
+			case SmallCopy:
+				size = 2
+			case BigCopy:
+				size = 3
+			}
+			pos += size
+			upos += int64(tok.Length)
+		}
+		if pos != int64(buf.Len()) || toks[len(toks)-1].Kind != FlushMark {
+			t.Fatalf("tokens end at %d, stream len %d", pos, buf.Len())
+		}
+	}
+}
+
+func TestTokenReaderErrors(t *testing.T) {
+	for _, c := range []struct {
+		in  []byte
+		pos int64
+	}{{[]byte{3, 'a', 'b'}, 0}, {[]byte{0x1f}, 0}, {[]byte{1, 'a', 0x20}, 2}, {[]byte{1, 'a', 0xf0, 0}, 2}} {
+		_, _, err := readTokens(t, NewTokenReader(bytes.NewReader(c.in)))
+		if te, ok := err.(*TruncatedError); !ok || te.Offset != c.pos || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%v: %v", c.in, err)
+		}
+	}
+	_, _, err := readTokens(t, NewTokenReader(bytes.NewReader([]byte{2, 'a', 'b', 0, 0x20, 2})))
+	if ce, ok := err.(*CorruptError); !ok || ce.Offset != 4 {
+		t.Errorf("copy before start: %v", err)
+	}
+}
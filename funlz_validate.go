@@ -0,0 +1,88 @@
+package funlz
+
+import (
+	"bufio"
+	"io"
+)
+
+// ValidateResult is a summary of stream checked by Validate
+type ValidateResult struct {
+	Uncompressed int64 // bytes stream decodes to, up to first error
+	Compressed   int64 // bytes of input checked, up to first error
+	Segments     int64 // number of flush marks
+	Complete     bool  // stream ended with flush mark, see Reader.SetStrict
+	ErrorOffset  int64 // compressed offset of first error, or -1
+}
+
+/*
+Validate checks raw stream as Reader does, but decoded bytes are not produced:
+literals are skipped and copies are checked against history length only,
+so it is much faster than reading stream into ioutil.Discard.
+
+	res, err := funlz.Validate(f)
+	if err != nil {
+		log.Printf("broken at %d: %v", res.ErrorOffset, err)
+	}
+
+Error is *CorruptError, *TruncatedError or error of input.
+*/
+func Validate(rd io.Reader) (ValidateResult, error) {
+	return ValidateDict(rd, nil)
+}
+
+// ValidateDict checks stream compressed with preset dictionary d, see Validate
+func ValidateDict(rd io.Reader, d *Dictionary) (res ValidateResult, err error) {
+	br, ok := rd.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(rd, 1<<16)
+	}
+	var dict int32
+	if d != nil {
+		dict = int32(len(d.data))
+	}
+	hist := dict
+	res.Complete = true
+	res.ErrorOffset = -1
+	fail := func(err error) (ValidateResult, error) {
+		res.ErrorOffset = res.Compressed
+		return res, err
+	}
+	for {
+		var tag byte
+		if tag, err = br.ReadByte(); err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return fail(err)
+		}
+		start := res.Compressed
+		var l, off int32
+		var n int /* token length */
+		if l, off, n, err = readHeader(br, tag, start); err != nil {
+			return fail(err)
+		}
+		if l == 0 {
+			res.Compressed += int64(n)
+			res.Segments++
+			res.Complete = true
+			if d != nil {
+				hist = dict
+			}
+			continue
+		}
+		if off == 0 {
+			if _, err = br.Discard(int(l)); err != nil {
+				return fail(truncated(err, start))
+			}
+			n += int(l)
+		} else if off > hist {
+			/* refers before start of stream or dictionary */
+			return fail(&CorruptError{Offset: start})
+		}
+		res.Compressed += int64(n)
+		res.Uncompressed += int64(l)
+		res.Complete = false
+		if hist += l; hist > window {
+			hist = window
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package funlz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	res, err := Validate(bytes.NewReader(compressed))
+	if err != nil || res.Uncompressed != int64(len(original)) || res.Compressed != int64(len(compressed)) ||
+		!res.Complete || res.ErrorOffset != -1 || res.Segments != 1 {
+		t.Errorf("%+v %v", res, err)
+	}
+	c, cpos, _ := segmented(original[:100000], 1000)
+	if res, err = Validate(bytes.NewReader(c)); err != nil || res.Segments != int64(len(cpos)) {
+		t.Errorf("segmented: %+v %v", res, err)
+	}
+	/* cut after literal of 5 bytes */
+	if res, err = Validate(bytes.NewReader(c[:len(c)-1])); err != nil || res.Complete {
+		t.Errorf("without last flush mark: %+v %v", res, err)
+	}
+	res, err = Validate(bytes.NewReader([]byte("\x02ab\x00\x02ab\x30\x05")))
+	if !errors.Is(err, ErrCorrupt) || res.ErrorOffset != 7 || res.Uncompressed != 4 || res.Segments != 1 {
+		t.Errorf("copy before start: %+v %v", res, err)
+	}
+	res, err = Validate(bytes.NewReader([]byte("\x02ab\x00\x1f\x01abc")))
+	if !errors.Is(err, ErrTruncated) || res.ErrorOffset != 4 || res.Compressed != 4 {
+		t.Errorf("truncated literal: %+v %v", res, err)
+	}
+
+	dict := NewDictionary(original[:4096])
+	var out bytes.Buffer
+	w := NewWriterDict(&out, dict)
+	w.Write(original[4096:20000])
+	w.Close()
+	if res, err = ValidateDict(bytes.NewReader(out.Bytes()), dict); err != nil || res.Uncompressed != 20000-4096 {
+		t.Errorf("dictionary: %+v %v", res, err)
+	}
+	if _, err = Validate(bytes.NewReader(out.Bytes())); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("without dictionary: %v", err)
+	}
+}
+
+/* Validate should agree with Reader on damaged streams */
+func TestValidateReader(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		c := append([]byte(nil), compressed11111...)
+		for j := rnd.Intn(3); j >= 0; j-- {
+			c[rnd.Intn(len(c))] = byte(rnd.Intn(256))
+		}
+		c = c[:rnd.Intn(len(c)+1)]
+		res, err := Validate(bytes.NewReader(c))
+		d, rerr := ioutil.ReadAll(NewReader(bytes.NewReader(c)))
+		if (err == nil) != (rerr == nil) || res.Uncompressed != int64(len(d)) {
+			t.Fatalf("Validate %+v %v, Reader %d bytes %v", res, err, len(d), rerr)
+		}
+		var ce *CorruptError
+		if errors.As(rerr, &ce) && ce.Offset != res.ErrorOffset {
+			t.Fatalf("Validate error at %d, Reader at %d", res.ErrorOffset, ce.Offset)
+		}
+	}
+}
+
+func BenchmarkValidateBig(b *testing.B) {
+	b.SetBytes(int64(len(original)))
+	for i := 0; i < b.N; i++ {
+		Validate(bytes.NewReader(compressed))
+	}
+}